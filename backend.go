@@ -0,0 +1,269 @@
+package hippy
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/itsmontoya/lineFile"
+)
+
+// Backend is a line-oriented store used for the log and archive of a database
+// Note: Lines never contain a newline character. Backends are not required to be thread safe, Hippy manages locks
+type Backend interface {
+	// Append will append a line, the line is not durable until Flush is called
+	Append(line []byte) error
+	// Flush will make all appended lines durable
+	Flush() error
+	// ReadFrom will call the provided func for every line starting at the provided line index, in order.
+	// Iteration will end early if the provided func returns true. Lines beyond the end of the backend are not an error
+	// Note: The provided buffer is only valid for the duration of the call
+	ReadFrom(line int, fn func(*bytes.Buffer) (end bool)) error
+	// Truncate will remove every line from the provided line index onward
+	Truncate(line int) error
+	// Replace will atomically replace all lines with the lines written by the provided func. The existing lines are
+	// left in place if the func or the replacement fails
+	Replace(fn func(write func([]byte) error) error) error
+	// Close will close the backend
+	Close() error
+}
+
+// Sizer is implemented by backends which are able to report their size in bytes, see Stats
+type Sizer interface {
+	// Size will return the size of all durable lines in bytes
+	Size() (int64, error)
+}
+
+// newFileBackend will return a new Backend backed by a lineFile
+func newFileBackend(opts lineFile.Opts) (fb *fileBackend, err error) {
+	var f *lineFile.File
+	if f, err = lineFile.New(opts); err != nil {
+		return
+	}
+
+	fb = &fileBackend{
+		f:      f,
+		opts:   opts,
+		rename: os.Rename,
+	}
+
+	// Index the byte offsets of our existing lines so that we may truncate in place
+	if err = fb.ReadFrom(0, func(b *bytes.Buffer) (end bool) {
+		fb.offs = append(fb.offs, fb.size)
+		fb.size += int64(b.Len() + 1)
+		return
+	}); err != nil {
+		fb = nil
+		f.Close()
+		return
+	}
+
+	// A torn final line is not terminated, our size is taken from our file
+	var fi os.FileInfo
+	if fi, err = os.Stat(f.Location()); err == nil {
+		fb.size = fi.Size()
+	}
+
+	return
+}
+
+// fileBackend is a Backend backed by a lineFile
+type fileBackend struct {
+	f    *lineFile.File
+	opts lineFile.Opts
+
+	offs []int64 // Byte offset of each line
+	size int64   // Byte offset following our last line
+
+	// Renames our replacement over our file, tests replace it to inject faults
+	rename func(from, to string) error
+}
+
+// Append will append a line
+func (fb *fileBackend) Append(line []byte) (err error) {
+	if err = fb.f.WriteLine(line); err != nil {
+		return
+	}
+
+	fb.offs = append(fb.offs, fb.size)
+	fb.size += int64(len(line) + 1)
+	return
+}
+
+// Flush will flush our file
+func (fb *fileBackend) Flush() error {
+	return fb.f.Flush()
+}
+
+// ReadFrom will call the provided func for every line starting at the provided line index
+func (fb *fileBackend) ReadFrom(line int, fn func(*bytes.Buffer) (end bool)) (err error) {
+	if line == 0 {
+		err = fb.f.SeekToStart()
+	} else {
+		err = fb.f.SeekToLine(line)
+	}
+
+	if err != nil {
+		// Line does not exist, our file has no further lines
+		err = nil
+		goto END
+	}
+
+	err = fb.f.ReadLines(fn)
+
+END:
+	// Ensure our file is positioned at the end for subsequent writes
+	fb.f.SeekToEnd()
+	return
+}
+
+// Truncate will remove every line from the provided line index onward, the remaining lines are durable
+// Note: lineFile cannot truncate in place, our file is closed and truncated at the byte offset of the line before it is
+// re-opened. The retained lines are only copied to a replacement if our file cannot be truncated
+func (fb *fileBackend) Truncate(line int) (err error) {
+	if err = fb.f.Flush(); err != nil || line >= len(fb.offs) {
+		return
+	}
+
+	if err = fb.f.Close(); err != nil {
+		return
+	}
+
+	if terr := os.Truncate(fb.f.Location(), fb.offs[line]); terr != nil {
+		// Re-open our original file and fall back to copying our retained lines
+		if err = fb.f.Open(); err != nil {
+			return
+		}
+
+		fb.f.SeekToEnd()
+		return fb.truncateCopy(line)
+	}
+
+	if err = fb.f.Open(); err != nil {
+		return
+	}
+
+	fb.size = fb.offs[line]
+	fb.offs = fb.offs[:line]
+	return fb.f.SeekToEnd()
+}
+
+// truncateCopy will remove every line from the provided line index onward by replacing our file with a copy of the
+// retained lines
+func (fb *fileBackend) truncateCopy(line int) (err error) {
+	var (
+		ls [][]byte
+		li int // Line index
+	)
+
+	if err = fb.ReadFrom(0, func(b *bytes.Buffer) (end bool) {
+		if li == line {
+			return true
+		}
+
+		ls = append(ls, append([]byte(nil), b.Bytes()...))
+		li++
+		return
+	}); err != nil {
+		return
+	}
+
+	return fb.Replace(func(write func([]byte) error) (err error) {
+		for _, l := range ls {
+			if err = write(l); err != nil {
+				return
+			}
+		}
+
+		return
+	})
+}
+
+// Replace will write the provided lines to a temporary file which is renamed over our file
+func (fb *fileBackend) Replace(fn func(write func([]byte) error) error) (err error) {
+	var (
+		tf   *lineFile.File
+		tfo  bool    // Temporary file open boolean
+		offs []int64 // Byte offset of each line of our replacement
+		size int64   // Byte offset following the last line of our replacement
+	)
+
+	topts := fb.opts
+	topts.Name += ".tmp"
+	topts.NoSet = true
+	if tf, err = lineFile.New(topts); err != nil {
+		return
+	}
+
+	// A replacement left behind by a crash must not be carried into ours
+	if err = os.Remove(tf.Location()); err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	if err = tf.Open(); err != nil {
+		return
+	}
+
+	tfo = true
+	defer func() {
+		if tfo {
+			// We failed before our temporary file was closed, ensure it is not left open
+			tf.Close()
+		}
+
+		if err != nil {
+			// Remove our replacement, our original file remains in place
+			os.Remove(tf.Location())
+		}
+	}()
+
+	if err = fn(func(line []byte) (err error) {
+		if err = tf.WriteLine(line); err == nil {
+			offs = append(offs, size)
+			size += int64(len(line) + 1)
+		}
+
+		return
+	}); err != nil {
+		return
+	}
+
+	tfo = false
+	if err = tf.Close(); err != nil {
+		return
+	}
+
+	if err = fb.f.Close(); err != nil {
+		return
+	}
+
+	if err = fb.rename(tf.Location(), fb.f.Location()); err != nil {
+		// Re-open our original file so that we remain usable
+		fb.f.Open()
+		fb.f.SeekToEnd()
+		return
+	}
+
+	fb.offs = offs
+	fb.size = size
+	if err = fb.f.Open(); err != nil {
+		return
+	}
+
+	return fb.f.SeekToEnd()
+}
+
+// Size will return the size of our file in bytes
+func (fb *fileBackend) Size() (n int64, err error) {
+	var fi os.FileInfo
+	if fi, err = os.Stat(fb.f.Location()); err != nil {
+		return
+	}
+
+	n = fi.Size()
+	return
+}
+
+// Close will close our file
+func (fb *fileBackend) Close() error {
+	return fb.f.Close()
+}
@@ -0,0 +1,199 @@
+package hippy
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+// ErrInjectedFault is returned by a FaultBackend once it's fault has been triggered
+const ErrInjectedFault = errors.Error("injected fault")
+
+// NewFaultBackend will return a new fault backend
+func NewFaultBackend() *FaultBackend {
+	return &FaultBackend{
+		m:         NewMemoryBackend(),
+		remaining: -1,
+	}
+}
+
+// FaultBackend is an in-memory Backend which is able to inject faults and simulate crashes, it is intended for crash testing.
+// Appended lines are lost by a crash unless they have been flushed, and a replacement is only ever applied in full.
+// A torn line is left unterminated as it would be within a file, the next appended line is joined to it
+type FaultBackend struct {
+	mux sync.Mutex
+	m   *MemoryBackend
+
+	remaining int    // Writes remaining before our fault is triggered, negative when disabled
+	failed    bool   // Fault triggered state
+	torn      bool   // Torn state, set when our final durable line is unterminated
+	frag      []byte // Torn fragment which our first unflushed line was joined to, it remains durable if that line is lost
+}
+
+// FailAfter will allow the provided number of writes to succeed, after which every write will fail with ErrInjectedFault.
+// A negative number will disable our fault. Appends, flushes, truncations, each line written by a replacement, and the completion of a replacement are counted as writes
+func (fb *FaultBackend) FailAfter(n int) {
+	fb.mux.Lock()
+	fb.remaining = n
+	fb.failed = false
+	fb.mux.Unlock()
+}
+
+// Failed will return whether or not our fault has been triggered
+func (fb *FaultBackend) Failed() (failed bool) {
+	fb.mux.Lock()
+	failed = fb.failed
+	fb.mux.Unlock()
+	return
+}
+
+// Crash will simulate a crash and restart, all but the provided number of unflushed lines are lost and any pending fault
+// is cleared. When tear is true, a partial copy of the next unflushed line is left behind as though it was torn mid-write
+func (fb *FaultBackend) Crash(n int, tear bool) {
+	fb.mux.Lock()
+	fb.m.mux.Lock()
+	if n > len(fb.m.pending) {
+		n = len(fb.m.pending)
+	}
+
+	fb.m.lines = append(fb.m.lines, fb.m.pending[:n]...)
+	switch {
+	case tear && n < len(fb.m.pending):
+		l := fb.m.pending[n]
+		cut := (len(l) + 1) / 2
+		if n == 0 && len(fb.frag) > 0 {
+			// Our line continues a torn fragment which is already durable, only the remainder may be torn
+			cut = len(fb.frag) + (len(l)-len(fb.frag)+1)/2
+		}
+
+		fb.m.lines = append(fb.m.lines, l[:cut])
+		fb.torn = true
+	case n == 0 && len(fb.frag) > 0:
+		// The line joined to our torn fragment was lost, our fragment remains
+		fb.m.lines = append(fb.m.lines, fb.frag)
+	case n > 0:
+		fb.torn = false
+	}
+
+	fb.m.pending = nil
+	fb.frag = nil
+	fb.m.mux.Unlock()
+
+	fb.remaining = -1
+	fb.failed = false
+	fb.mux.Unlock()
+}
+
+// write will consume a write, ErrInjectedFault is returned once our fault has been triggered
+func (fb *FaultBackend) write() (err error) {
+	fb.mux.Lock()
+	switch {
+	case fb.failed:
+		err = ErrInjectedFault
+	case fb.remaining == 0:
+		fb.failed = true
+		err = ErrInjectedFault
+	case fb.remaining > 0:
+		fb.remaining--
+	}
+	fb.mux.Unlock()
+	return
+}
+
+// Append will append a line
+func (fb *FaultBackend) Append(line []byte) (err error) {
+	if err = fb.write(); err != nil {
+		return
+	}
+
+	fb.mux.Lock()
+	defer fb.mux.Unlock()
+	if !fb.torn {
+		return fb.m.Append(line)
+	}
+
+	// Our final durable line is unterminated, our line is joined to it as it would be within a file
+	fb.m.mux.Lock()
+	last := len(fb.m.lines) - 1
+	fb.frag = fb.m.lines[last]
+	fb.m.lines = fb.m.lines[:last]
+	fb.m.pending = append(fb.m.pending, append(append([]byte(nil), fb.frag...), line...))
+	fb.m.mux.Unlock()
+
+	fb.torn = false
+	return
+}
+
+// Flush will make all appended lines durable
+func (fb *FaultBackend) Flush() (err error) {
+	if err = fb.write(); err != nil {
+		return
+	}
+
+	fb.mux.Lock()
+	fb.frag = nil
+	fb.mux.Unlock()
+	return fb.m.Flush()
+}
+
+// ReadFrom will call the provided func for every line starting at the provided line index
+func (fb *FaultBackend) ReadFrom(line int, fn func(*bytes.Buffer) (end bool)) error {
+	return fb.m.ReadFrom(line, fn)
+}
+
+// Truncate will remove every line from the provided line index onward
+func (fb *FaultBackend) Truncate(line int) (err error) {
+	if err = fb.write(); err != nil {
+		return
+	}
+
+	// Our remaining lines are rewritten in full and terminated
+	fb.clearTorn()
+	return fb.m.Truncate(line)
+}
+
+// Replace will replace all lines with the lines written by the provided func, our lines are left in place if a fault is triggered
+func (fb *FaultBackend) Replace(fn func(write func([]byte) error) error) error {
+	return fb.m.Replace(func(write func([]byte) error) (err error) {
+		if err = fn(func(line []byte) (err error) {
+			if err = fb.write(); err != nil {
+				return
+			}
+
+			return write(line)
+		}); err != nil {
+			return
+		}
+
+		// Our replacement is complete, the final write represents it's rename
+		if err = fb.write(); err == nil {
+			fb.clearTorn()
+		}
+
+		return
+	})
+}
+
+// clearTorn will clear our torn state once our lines have been rewritten
+func (fb *FaultBackend) clearTorn() {
+	fb.mux.Lock()
+	fb.torn = false
+	fb.frag = nil
+	fb.mux.Unlock()
+}
+
+// Size will return the size of all durable lines in bytes
+func (fb *FaultBackend) Size() (int64, error) {
+	return fb.m.Size()
+}
+
+// Close will close the backend
+func (fb *FaultBackend) Close() error {
+	return nil
+}
+
+// Lines will return a copy of the lines starting at the provided line index, including unflushed lines
+func (fb *FaultBackend) Lines(line int) [][]byte {
+	return fb.m.Lines(line)
+}
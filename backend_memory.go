@@ -0,0 +1,110 @@
+package hippy
+
+import (
+	"bytes"
+	"sync"
+)
+
+// NewMemoryBackend will return a new memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+// MemoryBackend is a Backend which stores it's lines in memory, it is intended for tests
+// Note: Lines are retained after Close, a database may be re-opened with the same backend
+type MemoryBackend struct {
+	mux sync.Mutex
+
+	lines   [][]byte // Durable lines
+	pending [][]byte // Lines appended since our last flush
+}
+
+// Append will append a line
+func (m *MemoryBackend) Append(line []byte) error {
+	m.mux.Lock()
+	m.pending = append(m.pending, append([]byte(nil), line...))
+	m.mux.Unlock()
+	return nil
+}
+
+// Flush will make all appended lines durable
+func (m *MemoryBackend) Flush() error {
+	m.mux.Lock()
+	m.lines = append(m.lines, m.pending...)
+	m.pending = nil
+	m.mux.Unlock()
+	return nil
+}
+
+// ReadFrom will call the provided func for every line starting at the provided line index, including unflushed lines
+func (m *MemoryBackend) ReadFrom(line int, fn func(*bytes.Buffer) (end bool)) error {
+	for _, l := range m.Lines(line) {
+		if fn(bytes.NewBuffer(l)) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Truncate will remove every line from the provided line index onward, the remaining lines are durable
+func (m *MemoryBackend) Truncate(line int) error {
+	m.mux.Lock()
+	m.lines = append(m.lines, m.pending...)
+	m.pending = nil
+	if line < len(m.lines) {
+		m.lines = m.lines[:line]
+	}
+	m.mux.Unlock()
+	return nil
+}
+
+// Replace will replace all lines with the lines written by the provided func
+func (m *MemoryBackend) Replace(fn func(write func([]byte) error) error) (err error) {
+	var ls [][]byte
+	if err = fn(func(line []byte) error {
+		ls = append(ls, append([]byte(nil), line...))
+		return nil
+	}); err != nil {
+		return
+	}
+
+	m.mux.Lock()
+	m.lines = ls
+	m.pending = nil
+	m.mux.Unlock()
+	return
+}
+
+// Size will return the size of all durable lines in bytes, each line is counted with it's trailing newline
+func (m *MemoryBackend) Size() (n int64, err error) {
+	m.mux.Lock()
+	for _, l := range m.lines {
+		n += int64(len(l) + 1)
+	}
+	m.mux.Unlock()
+	return
+}
+
+// Close will close the backend
+func (m *MemoryBackend) Close() error {
+	return nil
+}
+
+// Lines will return a copy of the lines starting at the provided line index, including unflushed lines
+func (m *MemoryBackend) Lines(line int) (ls [][]byte) {
+	m.mux.Lock()
+	for i, l := range m.lines {
+		if i >= line {
+			ls = append(ls, append([]byte(nil), l...))
+		}
+	}
+
+	for i, l := range m.pending {
+		if len(m.lines)+i >= line {
+			ls = append(ls, append([]byte(nil), l...))
+		}
+	}
+	m.mux.Unlock()
+	return
+}
@@ -0,0 +1,409 @@
+package hippy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentExt = ".seg"  // Extension of a segment appended to it's predecessors
+	baseExt    = ".base" // Extension of a segment which replaces it's predecessors
+	segmentLen = 20      // Length of an encoded segment number
+)
+
+// ObjectStore is a store of immutable objects, such as a cloud object store
+type ObjectStore interface {
+	// Get will return the contents of an object
+	Get(name string) ([]byte, error)
+	// Put will create or replace an object, the object must not be visible until it has been written in full
+	Put(name string, b []byte) error
+	// Delete will remove an object
+	Delete(name string) error
+	// List will return the names of all objects with the provided prefix, in sorted order
+	List(prefix string) ([]string, error)
+}
+
+// NewObjectBackend will return a new object backend which stores it's segments within the provided store under the provided prefix
+func NewObjectBackend(s ObjectStore, prefix string) (ob *ObjectBackend, err error) {
+	var segs []string
+	ob = &ObjectBackend{
+		s:      s,
+		prefix: prefix,
+		counts: make(map[string]int),
+	}
+
+	if segs, err = ob.list(); err != nil {
+		return
+	}
+
+	if len(segs) > 0 {
+		// Our next segment follows the last segment in our store
+		ob.next = ob.number(segs[len(segs)-1]) + 1
+	}
+
+	// Segments prior to our last base segment have been superseded
+	for i := len(segs) - 1; i > 0; i-- {
+		if strings.HasSuffix(segs[i], baseExt) {
+			segs = segs[i:]
+			break
+		}
+	}
+
+	ob.segs = segs
+	return
+}
+
+// ObjectBackend is a Backend which stores it's lines as immutable segments within an object store, it is intended for archives.
+// Every flush writes a new segment and every replacement writes a base segment, which supersedes all segments before it.
+// Our segments and their line counts are cached, segments which precede the line being read from are not fetched
+// Note: The backend expects to be the only writer of it's segments
+type ObjectBackend struct {
+	mux sync.Mutex
+
+	s      ObjectStore // Object store
+	prefix string      // Segment name prefix
+
+	segs   []string       // Segments from our current base segment onward, in order
+	counts map[string]int // Line counts of our segments, populated as they are written or read
+
+	pending [][]byte // Lines appended since our last flush
+	next    uint64   // Number of our next segment
+}
+
+// Append will append a line
+func (ob *ObjectBackend) Append(line []byte) error {
+	ob.mux.Lock()
+	ob.pending = append(ob.pending, append([]byte(nil), line...))
+	ob.mux.Unlock()
+	return nil
+}
+
+// Flush will write all appended lines as a new segment
+func (ob *ObjectBackend) Flush() (err error) {
+	var seg string
+	ob.mux.Lock()
+	if len(ob.pending) == 0 {
+		goto END
+	}
+
+	if seg, err = ob.put(segmentExt, ob.pending); err != nil {
+		goto END
+	}
+
+	ob.segs = append(ob.segs, seg)
+	ob.counts[seg] = len(ob.pending)
+	ob.pending = nil
+
+END:
+	ob.mux.Unlock()
+	return
+}
+
+// ReadFrom will call the provided func for every line starting at the provided line index, including unflushed lines
+func (ob *ObjectBackend) ReadFrom(line int, fn func(*bytes.Buffer) (end bool)) (err error) {
+	var (
+		segs    []string
+		ls      [][]byte
+		pending [][]byte
+		li      int // Line index
+	)
+
+	ob.mux.Lock()
+	segs = append(segs, ob.segs...)
+	pending = append(pending, ob.pending...)
+	ob.mux.Unlock()
+
+	for _, seg := range segs {
+		if n, ok := ob.count(seg); ok && li+n <= line {
+			// Every line of this segment precedes our line, it does not need to be fetched
+			li += n
+			continue
+		}
+
+		if ls, err = ob.read(seg); err != nil {
+			return
+		}
+
+		for _, l := range ls {
+			if li++; li <= line {
+				continue
+			}
+
+			if fn(bytes.NewBuffer(l)) {
+				return
+			}
+		}
+	}
+
+	for _, l := range pending {
+		if li++; li <= line {
+			continue
+		}
+
+		if fn(bytes.NewBuffer(l)) {
+			return
+		}
+	}
+
+	return
+}
+
+// Truncate will remove every line from the provided line index onward
+func (ob *ObjectBackend) Truncate(line int) (err error) {
+	var ls [][]byte
+	if err = ob.ReadFrom(0, func(b *bytes.Buffer) (end bool) {
+		if len(ls) == line {
+			return true
+		}
+
+		ls = append(ls, append([]byte(nil), b.Bytes()...))
+		return
+	}); err != nil {
+		return
+	}
+
+	ob.mux.Lock()
+	err = ob.replace(ls)
+	ob.mux.Unlock()
+	return
+}
+
+// Replace will write the lines written by the provided func as a new base segment
+func (ob *ObjectBackend) Replace(fn func(write func([]byte) error) error) (err error) {
+	var ls [][]byte
+	if err = fn(func(line []byte) error {
+		ls = append(ls, append([]byte(nil), line...))
+		return nil
+	}); err != nil {
+		return
+	}
+
+	ob.mux.Lock()
+	err = ob.replace(ls)
+	ob.mux.Unlock()
+	return
+}
+
+// Close will close the backend
+func (ob *ObjectBackend) Close() error {
+	return nil
+}
+
+// lineCount will return the number of lines within our backend, only segments with an unknown line count are fetched
+func (ob *ObjectBackend) lineCount() (n int, err error) {
+	var (
+		segs []string
+		ls   [][]byte
+	)
+
+	ob.mux.Lock()
+	segs = append(segs, ob.segs...)
+	n = len(ob.pending)
+	ob.mux.Unlock()
+
+	for _, seg := range segs {
+		c, ok := ob.count(seg)
+		if !ok {
+			if ls, err = ob.read(seg); err != nil {
+				return
+			}
+
+			c = len(ls)
+		}
+
+		n += c
+	}
+
+	return
+}
+
+// replace will write the provided lines as a new base segment and remove the segments it supersedes
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (ob *ObjectBackend) replace(ls [][]byte) (err error) {
+	var (
+		seg  string
+		segs []string
+		last = ob.next
+	)
+
+	if segs, err = ob.list(); err != nil {
+		return
+	}
+
+	if seg, err = ob.put(baseExt, ls); err != nil {
+		return
+	}
+
+	// Our base segment supersedes every cached segment
+	ob.segs = []string{seg}
+	ob.counts = map[string]int{seg: len(ls)}
+	ob.pending = nil
+	for _, seg := range segs {
+		if ob.number(seg) >= last {
+			continue
+		}
+
+		// Superseded segments are ignored by readers, a failed removal only leaves garbage behind
+		ob.s.Delete(seg)
+	}
+
+	return
+}
+
+// count will return the cached line count of a segment, ok is false when the segment has not been read
+func (ob *ObjectBackend) count(seg string) (n int, ok bool) {
+	ob.mux.Lock()
+	n, ok = ob.counts[seg]
+	ob.mux.Unlock()
+	return
+}
+
+// read will return the lines of a segment and cache it's line count
+func (ob *ObjectBackend) read(seg string) (ls [][]byte, err error) {
+	var b []byte
+	if b, err = ob.s.Get(seg); err != nil {
+		return
+	}
+
+	for _, l := range bytes.Split(b, []byte{_newline}) {
+		if len(l) > 0 {
+			ls = append(ls, l)
+		}
+	}
+
+	ob.mux.Lock()
+	ob.counts[seg] = len(ls)
+	ob.mux.Unlock()
+	return
+}
+
+// put will write the provided lines as our next segment, the name of the segment is returned
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (ob *ObjectBackend) put(ext string, ls [][]byte) (seg string, err error) {
+	var buf bytes.Buffer
+	for _, l := range ls {
+		buf.Write(l)
+		buf.WriteByte(_newline)
+	}
+
+	seg = fmt.Sprintf("%s%0*d%s", ob.prefix, segmentLen, ob.next, ext)
+	if err = ob.s.Put(seg, buf.Bytes()); err != nil {
+		return
+	}
+
+	ob.next++
+	return
+}
+
+// list will return the names of our segments within our store, in order
+func (ob *ObjectBackend) list() (segs []string, err error) {
+	var names []string
+	if names, err = ob.s.List(ob.prefix); err != nil {
+		return
+	}
+
+	for _, name := range names {
+		if ob.isSegment(name) {
+			segs = append(segs, name)
+		}
+	}
+
+	return
+}
+
+// isSegment will return whether or not the provided object name is one of our segments
+func (ob *ObjectBackend) isSegment(name string) bool {
+	name = strings.TrimPrefix(name, ob.prefix)
+	if len(name) <= segmentLen {
+		return false
+	}
+
+	if _, err := strconv.ParseUint(name[:segmentLen], 10, 64); err != nil {
+		return false
+	}
+
+	ext := name[segmentLen:]
+	return ext == segmentExt || ext == baseExt
+}
+
+// number will return the number of a segment
+func (ob *ObjectBackend) number(seg string) (n uint64) {
+	n, _ = strconv.ParseUint(strings.TrimPrefix(seg, ob.prefix)[:segmentLen], 10, 64)
+	return
+}
+
+// NewDirStore will return a new directory store, the directory is created if it does not exist
+func NewDirStore(dir string) (d *DirStore, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	d = &DirStore{dir: dir}
+	return
+}
+
+// DirStore is an ObjectStore backed by a local directory, it stands in for a remote object store
+type DirStore struct {
+	dir string
+}
+
+// Get will return the contents of an object
+func (d *DirStore) Get(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(d.dir, name))
+}
+
+// Put will write an object to a temporary file which is renamed into place
+func (d *DirStore) Put(name string, b []byte) (err error) {
+	var f *os.File
+	loc := filepath.Join(d.dir, name)
+	if f, err = os.Create(loc + ".tmp"); err != nil {
+		return
+	}
+
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(loc + ".tmp")
+		return
+	}
+
+	return os.Rename(loc+".tmp", loc)
+}
+
+// Delete will remove an object
+func (d *DirStore) Delete(name string) error {
+	return os.Remove(filepath.Join(d.dir, name))
+}
+
+// List will return the names of all objects with the provided prefix, in sorted order
+func (d *DirStore) List(prefix string) (names []string, err error) {
+	var fis []os.FileInfo
+	if fis, err = ioutil.ReadDir(d.dir); err != nil {
+		return
+	}
+
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
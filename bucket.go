@@ -0,0 +1,348 @@
+package hippy
+
+import "sort"
+
+// buckets stores the in-memory storage by bucket name
+type buckets map[string]storage
+
+// bucketActions stores the pending actions for a bucket
+type bucketActions struct {
+	// Drop state, when true the bucket is deleted before the actions are applied
+	drop bool
+	// Actions map
+	a map[string]action
+}
+
+// bucketChanges stores the pending bucket actions by bucket name
+type bucketChanges map[string]*bucketActions
+
+// get will return the pending actions for a bucket, creating them if they do not exist
+func (bc bucketChanges) get(name string) (ba *bucketActions) {
+	if ba = bc[name]; ba == nil {
+		ba = &bucketActions{a: make(map[string]action)}
+		bc[name] = ba
+	}
+
+	return
+}
+
+// drop will mark a bucket as dropped and clear any of it's pending actions
+func (bc bucketChanges) drop(name string) {
+	ba := bc.get(name)
+	ba.drop = true
+	for k := range ba.a {
+		delete(ba.a, k)
+	}
+}
+
+// reset will remove all pending bucket actions
+func (bc bucketChanges) reset() {
+	for k := range bc {
+		delete(bc, k)
+	}
+}
+
+// newBucketBody will return an encoded bucket log line body for the provided key and value
+func newBucketBody(key string, val []byte) (b []byte) {
+	b = make([]byte, 0, 1+len(key)+len(val))
+	b = append(b, uint8(len(key)))
+	b = append(b, key...)
+	b = append(b, val...)
+	return
+}
+
+// parseBucketBody will return a key and value from an encoded bucket log line body
+func parseBucketBody(b []byte) (key string, val []byte, err error) {
+	if len(b) == 0 || len(b) < 1+int(b[0]) {
+		err = ErrInvalidLogLine
+		return
+	}
+
+	kl := int(b[0]) + 1
+	key = string(b[1:kl])
+	val = b[kl:]
+	return
+}
+
+// isValidBucket will return whether or not the provided bucket name is valid
+func isValidBucket(name string) bool {
+	return len(name) > 0 && len(name) <= MaxKeyLen
+}
+
+// ReadBucket is a read-only view of a bucket
+type ReadBucket struct {
+	// Pointer to our DB's internal store
+	h *Hippy
+	// Bucket name
+	name string
+}
+
+// Get will get a body and an ok value
+func (r *ReadBucket) Get(k string) (b []byte, ok bool) {
+	var tgt []byte
+	// Get a non-pointer reference to bucket storage
+	if tgt, ok = r.h.b[r.name][k]; !ok {
+		// Target does not exist, return
+		return
+	}
+
+	if !r.h.opts.CopyOnRead {
+		b = tgt
+		return
+	}
+
+	// Pre-allocate b to be the length of target
+	b = make([]byte, len(tgt))
+	// Copy target to b
+	copy(b, tgt)
+	return
+}
+
+// Keys will list the keys for a bucket
+func (r *ReadBucket) Keys() (keys []string) {
+	s := r.h.b[r.name]
+	// Pre-allocate keys to be the length of our bucket storage
+	keys = make([]string, 0, len(s))
+
+	// For each item in our bucket storage, append key to keys
+	for k := range s {
+		keys = append(keys, k)
+	}
+
+	return
+}
+
+// ForEach will iterate through all the items within a bucket in key order
+// Note: Iteration will end early if the provided func returns an error
+func (r *ReadBucket) ForEach(fn func(k string, v []byte) error) (err error) {
+	keys := r.Keys()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err = fn(k, r.h.b[r.name][k]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ReadWriteBucket is a read/write view of a bucket
+type ReadWriteBucket struct {
+	// Pointer to the parent transaction
+	tx *ReadWriteTx
+	// Bucket name
+	name string
+}
+
+// Get will get a body and an ok value
+func (rw *ReadWriteBucket) Get(k string) (b []byte, ok bool) {
+	rw.tx.mux.RLock()
+	b, ok = rw.get(k)
+	rw.tx.mux.RUnlock()
+	return
+}
+
+// get will get a body and an ok value
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (rw *ReadWriteBucket) get(k string) (b []byte, ok bool) {
+	var (
+		ta  action
+		tgt []byte
+	)
+
+	if ba, exists := rw.tx.b[rw.name]; exists {
+		// If action exists for this key..
+		if ta, ok = ba.a[k]; ok {
+			// If action is PUT, set our target to the action body and goto copy
+			if ta.a == _put {
+				tgt = ta.b
+				goto COPY
+			}
+
+			// Action was DELETE, set ok to false and return
+			ok = false
+			return
+		}
+
+		if ba.drop {
+			// Bucket is being dropped within this transaction, return
+			return
+		}
+	}
+
+	// Get a non-pointer reference to bucket storage
+	if tgt, ok = rw.tx.h.b[rw.name][k]; !ok {
+		// Target does not exist, return
+		return
+	}
+
+COPY:
+	if !rw.tx.h.opts.CopyOnRead {
+		b = tgt
+		return
+	}
+
+	// Pre-allocate b to be the length of target
+	b = make([]byte, len(tgt))
+	// Copy target to b
+	copy(b, tgt)
+	return
+}
+
+// Put will put
+func (rw *ReadWriteBucket) Put(k string, v []byte) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if !isValidBucket(rw.name) {
+		return ErrInvalidBucket
+	}
+
+	// Create action
+	act := action{a: _put}
+	if !rw.tx.h.opts.CopyOnWrite {
+		// Set action body to value and goto the end
+		act.b = v
+		goto END
+	}
+
+	// Pre-allocate action body to be the length of value
+	act.b = make([]byte, len(v))
+	// Copy value to action body
+	copy(act.b, v)
+
+END:
+	rw.tx.mux.Lock()
+	rw.tx.b.get(rw.name).a[k] = act
+	rw.tx.mux.Unlock()
+	return
+}
+
+// Del will delete
+func (rw *ReadWriteBucket) Del(k string) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if !isValidBucket(rw.name) {
+		return ErrInvalidBucket
+	}
+
+	rw.tx.mux.Lock()
+	// Set a delete action
+	rw.tx.b.get(rw.name).a[k] = action{
+		a: _del,
+	}
+	rw.tx.mux.Unlock()
+	return
+}
+
+// Keys will list the keys for a bucket, including any changes made within this transaction
+func (rw *ReadWriteBucket) Keys() (keys []string) {
+	rw.tx.mux.RLock()
+	keys = rw.keys()
+	rw.tx.mux.RUnlock()
+	return
+}
+
+// keys will list the keys for a bucket, including any changes made within this transaction
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (rw *ReadWriteBucket) keys() (keys []string) {
+	ba := rw.tx.b[rw.name]
+	if ba == nil || !ba.drop {
+		// For each item in our bucket storage which has not been modified, append key to keys
+		for k := range rw.tx.h.b[rw.name] {
+			if ba != nil {
+				if _, ok := ba.a[k]; ok {
+					continue
+				}
+			}
+
+			keys = append(keys, k)
+		}
+	}
+
+	if ba == nil {
+		return
+	}
+
+	// For each put action, append key to keys
+	for k, act := range ba.a {
+		if act.a == _put {
+			keys = append(keys, k)
+		}
+	}
+
+	return
+}
+
+// ForEach will iterate through all the items within a bucket in key order, including any changes made within this transaction
+// Note: Iteration will end early if the provided func returns an error
+func (rw *ReadWriteBucket) ForEach(fn func(k string, v []byte) error) (err error) {
+	rw.tx.mux.RLock()
+	keys := rw.keys()
+	rw.tx.mux.RUnlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok := rw.Get(k)
+		if !ok {
+			continue
+		}
+
+		if err = fn(k, v); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// WriteBucket is a write-only view of a bucket
+type WriteBucket struct {
+	// Pointer to the parent transaction
+	tx *WriteTx
+	// Bucket name
+	name string
+}
+
+// Put will put
+func (w *WriteBucket) Put(k string, v []byte) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if !isValidBucket(w.name) {
+		return ErrInvalidBucket
+	}
+
+	w.tx.mux.Lock()
+	// Set a put action with the body
+	w.tx.b.get(w.name).a[k] = action{
+		a: _put,
+		b: v,
+	}
+	w.tx.mux.Unlock()
+	return
+}
+
+// Del will delete
+func (w *WriteBucket) Del(k string) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if !isValidBucket(w.name) {
+		return ErrInvalidBucket
+	}
+
+	w.tx.mux.Lock()
+	// Set a delete action
+	w.tx.b.get(w.name).a[k] = action{
+		a: _del,
+	}
+	w.tx.mux.Unlock()
+	return
+}
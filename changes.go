@@ -0,0 +1,203 @@
+package hippy
+
+import "bytes"
+
+// changesBatchSize is the number of commits read from disk per lock acquisition while reading changes
+const changesBatchSize = 128
+
+// Commit is a committed transaction read from the log
+type Commit struct {
+	// Log sequence number of the commit
+	LSN uint64
+	// Changes made by the commit
+	Events []Event
+
+	// Raw log lines of the commit, only populated when reading for replication
+	lines [][]byte
+}
+
+// LSN will return the log sequence number of the last commit
+func (h *Hippy) LSN() (lsn uint64) {
+	h.mux.RLock()
+	lsn = h.seq
+	h.mux.RUnlock()
+	return
+}
+
+// ChangesSince will call the provided func for every commit after the provided log sequence number, in order.
+// Changes are read from the archive when they are no longer within the log. ErrLSNUnavailable is returned when
+// the changes following the log sequence number have been compacted without being archived, including while iterating
+// Note: Iteration will end early if the provided func returns an error. ErrInMemory is returned for in-memory instances
+func (h *Hippy) ChangesSince(lsn uint64, fn func(Commit) error) (err error) {
+	var cs []Commit
+	if h.opts.InMemory {
+		// We do not have a log to read our changes from
+		return ErrInMemory
+	}
+
+SEEK:
+	for _, tgt := range []Backend{h.af, h.f} {
+		var (
+			line int  // Line index to continue reading from
+			gen  int  // Log generation our line index belongs to
+			done bool // End of file reached
+			seek bool // Our log was replaced since our last read
+		)
+
+		for !done {
+			h.mux.Lock()
+			switch {
+			case h.closed:
+				err = ErrIsClosed
+			case line > 0 && gen != h.gen:
+				seek = true
+			default:
+				gen = h.gen
+				cs, line, done, err = h.readCommits(tgt, line, lsn, false)
+			}
+			h.mux.Unlock()
+
+			if err != nil {
+				return
+			}
+
+			if seek {
+				// Our line index is stale, seek to our log sequence number from the start of our archive. Commits which
+				// were compacted without being archived will return ErrLSNUnavailable
+				goto SEEK
+			}
+
+			for _, c := range cs {
+				if err = fn(c); err != nil {
+					return
+				}
+
+				lsn = c.LSN
+			}
+		}
+	}
+
+	return
+}
+
+// readCommits will read up to changesBatchSize commits following the provided log sequence number, starting at the provided line index.
+// The returned line index is the line following the last returned commit. When raw is true, the raw log lines of each commit are
+// retained (including any hash lines which precede the commit), a lease is returned as a commit without events and a compacted snapshot
+// is returned as a commit when reading from a log sequence number of zero
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) readCommits(tgt Backend, start int, lsn uint64, raw bool) (cs []Commit, line int, done bool, err error) {
+	var (
+		key string
+		act action
+		n   int64
+		es  []Event  // Events for the current transaction
+		ls  [][]byte // Raw lines for the current transaction
+		li  = start  // Line index
+	)
+
+	line = start
+	done = true
+	rerr := tgt.ReadFrom(start, func(b *bytes.Buffer) (ok bool) {
+		li++
+		if raw {
+			// Retain a copy of the raw line before it is consumed by parsing
+			ls = append(ls, append([]byte(nil), b.Bytes()...))
+		}
+
+		if key, act, err = h.parseLogLine(b); err != nil {
+			return true
+		}
+
+		switch act.a {
+		case _put, _del, _bput, _bdel, _bdrop:
+			var e Event
+			if e, err = newRecordEvent(key, act); err != nil {
+				return true
+			}
+
+			es = append(es, e)
+			return
+
+		case _commit, _checkpoint:
+			if n, err = DecodeInt64(act.b); err != nil {
+				return true
+			}
+
+		case _lease:
+			if !raw || len(es) > 0 {
+				// Leases within a compacted snapshot accompany it's checkpoint
+				return
+			}
+
+			// Leases are written outside of transactions, they are returned as soon as they are read so that followers
+			// learn of them without waiting on a commit. Our log sequence number is unchanged
+			cs = append(cs, Commit{LSN: lsn, lines: ls})
+			ls = nil
+			line = li
+			return
+
+		default:
+			return
+		}
+
+		commit := act.a == _commit || (raw && lsn == 0)
+		switch {
+		case uint64(n) <= lsn:
+			// We have already seen this commit
+		case !commit || (act.a == _commit && uint64(n) != lsn+1):
+			// Our next commit was compacted prior to being archived
+			err = ErrLSNUnavailable
+			return true
+		default:
+			for i := range es {
+				es[i].Seq = uint64(n)
+			}
+
+			cs = append(cs, Commit{LSN: uint64(n), Events: es, lines: ls})
+			lsn = uint64(n)
+		}
+
+		es = nil
+		ls = nil
+		line = li
+
+		if len(cs) == changesBatchSize {
+			// Batch is full, let the caller know there is more to read
+			done = false
+			return true
+		}
+
+		return
+	})
+
+	if err == nil {
+		err = rerr
+	}
+
+	return
+}
+
+// newRecordEvent will return a new event for a parsed log record
+func newRecordEvent(key string, act action) (e Event, err error) {
+	var (
+		k string
+		v []byte
+	)
+
+	switch act.a {
+	case _put, _del:
+		return newEvent(0, "", key, act), nil
+	case _bdrop:
+		return Event{Type: EventDropBucket, Bucket: key}, nil
+	}
+
+	if k, v, err = parseBucketBody(act.b); err != nil {
+		return
+	}
+
+	if act.a == _bput {
+		return newEvent(0, key, k, action{a: _put, b: v}), nil
+	}
+
+	return newEvent(0, key, k, action{a: _del}), nil
+}
@@ -0,0 +1,170 @@
+// Package client is a client for a Hippy server
+package client
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/itsmontoya/hippy/internal/wire"
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+// ErrInvalidResponse is returned when a response does not contain a result for every operation of it's request
+const ErrInvalidResponse = errors.Error("invalid response")
+
+// Dial will connect to a Hippy server at the provided TCP address
+func Dial(addr string) (c *Client, err error) {
+	var conn net.Conn
+	if conn, err = net.Dial("tcp", addr); err != nil {
+		return
+	}
+
+	c = New(conn)
+	return
+}
+
+// New returns a new client for the provided connection
+func New(conn net.Conn) *Client {
+	return &Client{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+// Client is a client for a Hippy server, it is safe for concurrent use
+// Note: Requests are sent one at a time over a single connection
+type Client struct {
+	mux sync.Mutex
+
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	buf  []byte // Response buffer
+}
+
+// Get will get a value and an ok value
+func (c *Client) Get(key string) (val []byte, ok bool, err error) {
+	var rs []Result
+	if rs, err = c.Do(new(Batch).Get(key)); err != nil {
+		return
+	}
+
+	val = rs[0].Value
+	ok = rs[0].OK
+	return
+}
+
+// Put will put
+func (c *Client) Put(key string, val []byte) (err error) {
+	_, err = c.Do(new(Batch).Put(key, val))
+	return
+}
+
+// Del will delete
+func (c *Client) Del(key string) (err error) {
+	_, err = c.Do(new(Batch).Del(key))
+	return
+}
+
+// Keys will list the keys with the provided prefix, in key order
+func (c *Client) Keys(prefix string) (keys []string, err error) {
+	var rs []Result
+	if rs, err = c.Do(new(Batch).Keys(prefix)); err != nil {
+		return
+	}
+
+	keys = rs[0].Keys
+	return
+}
+
+// Do will execute a batch as a single transaction, returning a result for each operation in the order they were added.
+// No changes are committed if any operation fails
+func (c *Client) Do(b *Batch) (rs []Result, err error) {
+	var (
+		req []byte
+		wrs []wire.Result
+	)
+
+	if req, err = wire.EncodeRequest(b.ops); err != nil {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if err = wire.WriteFrame(c.w, req); err != nil {
+		return
+	}
+
+	if err = c.w.Flush(); err != nil {
+		return
+	}
+
+	if c.buf, err = wire.ReadFrame(c.r, c.buf); err != nil {
+		return
+	}
+
+	if wrs, err = wire.DecodeResponse(c.buf); err != nil {
+		return
+	}
+
+	if len(wrs) != len(b.ops) {
+		err = ErrInvalidResponse
+		return
+	}
+
+	rs = make([]Result, len(wrs))
+	for i, r := range wrs {
+		rs[i] = Result(r)
+	}
+
+	return
+}
+
+// Close will close the client's connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Batch is a batch of operations which are executed as a single transaction
+type Batch struct {
+	ops []wire.Op
+}
+
+// Get will add a GET operation
+func (b *Batch) Get(key string) *Batch {
+	b.ops = append(b.ops, wire.Op{Type: wire.OpGet, Key: key})
+	return b
+}
+
+// Put will add a PUT operation
+func (b *Batch) Put(key string, val []byte) *Batch {
+	b.ops = append(b.ops, wire.Op{Type: wire.OpPut, Key: key, Value: val})
+	return b
+}
+
+// Del will add a DELETE operation
+func (b *Batch) Del(key string) *Batch {
+	b.ops = append(b.ops, wire.Op{Type: wire.OpDel, Key: key})
+	return b
+}
+
+// Keys will add a KEYS operation for the provided prefix
+func (b *Batch) Keys(prefix string) *Batch {
+	b.ops = append(b.ops, wire.Op{Type: wire.OpKeys, Key: prefix})
+	return b
+}
+
+// Len will return the number of operations within the batch
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Result is the result of an operation
+type Result struct {
+	OK    bool     // Key exists, set for GET operations
+	Value []byte   // Value for GET operations
+	Keys  []string // Keys for KEYS operations
+}
@@ -0,0 +1,451 @@
+// hippy is a command line tool for inspecting and scripting a Hippy database.
+//
+//	hippy [flags] get <key>            Write the value of a key to stdout
+//	hippy [flags] put <key> [value]    Set the value of a key, the value is read from stdin when not provided
+//	hippy [flags] del <key>...         Delete keys
+//	hippy [flags] keys [prefix]        List keys with a prefix, in key order
+//	hippy [flags] dump [file]          Write a snapshot to a file, or stdout when not provided
+//	hippy [flags] load <file>          Replace the contents of the database with a snapshot
+//	hippy [flags] compact              Archive and then compact the log
+//	hippy [flags] archive              Archive the log
+//	hippy [flags] frombolt <file>      Copy the contents of a Bolt database into the database
+//	hippy [flags] tobolt <file>        Copy the contents of the database into a Bolt database, see -mapping
+//	hippy [flags] shell                Run commands interactively, one per line
+//
+// The database must be opened with the same middlewares it was created with, see -gzip, -key and -iv
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/itsmontoya/hippy"
+	"github.com/itsmontoya/hippy/migrate"
+	"github.com/itsmontoya/middleware"
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	errNotFound     = errors.Error("key not found")
+	errUsage        = errors.Error("invalid usage")
+	errUnknown      = errors.Error("unknown command")
+	errInvalidCrypt = errors.Error("-key and -iv must both be provided as hex")
+	errNestedShell  = errors.Error("shell cannot be run within a shell")
+	errMapping      = errors.Error("-mapping must be prefix or bucket")
+)
+
+// command is a CLI command
+type command struct {
+	usage    string
+	readOnly bool // Command does not modify the database, which is opened read-only
+	maintain bool // Command archives or compacts the database itself, which is not repeated on close
+	minArgs  int
+	maxArgs  int // Maximum number of arguments, unlimited when negative
+
+	fn func(db *hippy.Hippy, args []string, out io.Writer) error
+}
+
+var commands map[string]*command
+
+func init() {
+	// Initialized within init as the shell references our commands
+	commands = map[string]*command{
+		"get":      {usage: "get <key>", readOnly: true, minArgs: 1, maxArgs: 1, fn: get},
+		"put":      {usage: "put <key> [value]", minArgs: 1, maxArgs: 2, fn: put},
+		"del":      {usage: "del <key>...", minArgs: 1, maxArgs: -1, fn: del},
+		"keys":     {usage: "keys [prefix]", readOnly: true, maxArgs: 1, fn: keys},
+		"dump":     {usage: "dump [file]", readOnly: true, maxArgs: 1, fn: dump},
+		"load":     {usage: "load <file>", minArgs: 1, maxArgs: 1, fn: load},
+		"compact":  {usage: "compact", maintain: true, fn: compact},
+		"archive":  {usage: "archive", maintain: true, fn: archive},
+		"frombolt": {usage: "frombolt <file>", minArgs: 1, maxArgs: 1, fn: fromBolt},
+		"tobolt":   {usage: "tobolt <file>", readOnly: true, minArgs: 1, maxArgs: 1, fn: toBolt},
+		"shell":    {usage: "shell", fn: shell},
+	}
+}
+
+// Flags, commands read the flags which apply to them
+var (
+	path   = flag.String("path", ".", "directory containing the database")
+	name   = flag.String("name", "hippy", "name of the database")
+	config = flag.String("config", "", "ini file containing database options, default options are used when empty")
+	gzip   = flag.Bool("gzip", false, "open the database with the gzip middleware")
+	key    = flag.String("key", "", "hex encoded key for the crypty middleware")
+	iv     = flag.String("iv", "", "hex encoded IV for the crypty middleware")
+
+	ttl = flag.Duration("ttl", 0, "TTL for put, the key does not expire when zero")
+
+	mapping    = flag.String("mapping", "prefix", "how Bolt buckets are mapped for frombolt and tobolt, prefix or bucket")
+	separator  = flag.String("sep", migrate.DefaultSeparator, "separator between Bolt bucket names and keys")
+	rootBucket = flag.String("root", migrate.DefaultRootBucket, "Bolt bucket holding root keys")
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(*path, *name, *config, *gzip, *key, *iv, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "hippy:", err)
+		os.Exit(1)
+	}
+}
+
+// usage will print our usage to stderr
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: hippy [flags] <command> [args]\n\ncommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+// commandNames will return the names of our commands, in name order
+func commandNames() (names []string) {
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// run will open the database and execute a command
+func run(path, name, config string, gzip bool, key, iv string, args []string) (err error) {
+	var (
+		opts hippy.Opts
+		mws  []middleware.Middleware
+		db   *hippy.Hippy
+		src  interface{}
+	)
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return errUnknown
+	}
+
+	if len(config) > 0 {
+		src = config
+	}
+
+	if opts, err = hippy.NewOpts(src); err != nil {
+		return
+	}
+
+	if mws, err = newMiddlewares(gzip, key, iv); err != nil {
+		return
+	}
+
+	// Commands which do not modify the database should never archive or compact on close
+	opts.ReadOnly = opts.ReadOnly || cmd.readOnly
+	if cmd.maintain {
+		opts.ArchiveOnClose = false
+		opts.CompactOnClose = false
+	}
+
+	if db, err = hippy.New(path, name, opts, mws...); err != nil {
+		return
+	}
+
+	err = exec(db, args, os.Stdout)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+
+	return
+}
+
+// newMiddlewares will return the middlewares for the provided flags
+func newMiddlewares(gzip bool, key, iv string) (mws []middleware.Middleware, err error) {
+	if gzip {
+		mws = append(mws, middleware.GZipMW{})
+	}
+
+	if len(key) == 0 && len(iv) == 0 {
+		return
+	}
+
+	var k, i []byte
+	if k, err = hex.DecodeString(key); err != nil || len(k) == 0 {
+		return nil, errInvalidCrypt
+	}
+
+	if i, err = hex.DecodeString(iv); err != nil || len(i) == 0 {
+		return nil, errInvalidCrypt
+	}
+
+	mws = append(mws, middleware.NewCryptyMW(k, i))
+	return
+}
+
+// exec will execute a command against an open database
+func exec(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return errUnknown
+	}
+
+	if n := len(args) - 1; n < cmd.minArgs || (cmd.maxArgs >= 0 && n > cmd.maxArgs) {
+		return errors.Error(string(errUsage) + ", usage: " + cmd.usage)
+	}
+
+	return cmd.fn(db, args[1:], out)
+}
+
+// get will write the value of a key
+func get(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	var (
+		val []byte
+		ok  bool
+	)
+
+	if err = db.Read(func(txn *hippy.ReadTx) error {
+		val, ok = txn.Get(args[0])
+		return nil
+	}); err != nil {
+		return
+	}
+
+	if !ok {
+		return errNotFound
+	}
+
+	if _, err = out.Write(val); err != nil {
+		return
+	}
+
+	_, err = fmt.Fprintln(out)
+	return
+}
+
+// put will set the value of a key, reading the value from stdin when it is not provided
+func put(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	var val []byte
+	if len(args) == 2 {
+		val = []byte(args[1])
+	} else if val, err = io.ReadAll(os.Stdin); err != nil {
+		return
+	}
+
+	return db.ReadWrite(func(txn *hippy.ReadWriteTx) error {
+		if *ttl > 0 {
+			return txn.PutWithTTL(args[0], val, *ttl)
+		}
+
+		return txn.Put(args[0], val)
+	})
+}
+
+// del will delete keys
+func del(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	return db.ReadWrite(func(txn *hippy.ReadWriteTx) error {
+		for _, k := range args {
+			txn.Del(k)
+		}
+
+		return nil
+	})
+}
+
+// keys will list the keys with a prefix, in key order
+func keys(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	var (
+		ks     []string
+		prefix string
+	)
+
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+
+	if err = db.Read(func(txn *hippy.ReadTx) error {
+		for _, k := range txn.Keys() {
+			if strings.HasPrefix(k, prefix) {
+				ks = append(ks, k)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return
+	}
+
+	sort.Strings(ks)
+	w := bufio.NewWriter(out)
+	for _, k := range ks {
+		w.WriteString(k)
+		w.WriteByte('\n')
+	}
+
+	return w.Flush()
+}
+
+// dump will write a snapshot to a file, or out when a file is not provided
+func dump(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	if len(args) == 1 {
+		return db.SaveTo(args[0])
+	}
+
+	return db.Backup(out)
+}
+
+// load will replace the contents of the database with a snapshot
+func load(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	return db.LoadFrom(args[0])
+}
+
+// compact will archive and then compact the log, so that no history is discarded
+func compact(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	if err = archive(db, args, out); err != nil {
+		return
+	}
+
+	return db.Compact()
+}
+
+// archive will archive the log, a log without changes is not an error
+func archive(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	if err = db.Archive(); err == hippy.ErrNoChanges {
+		err = nil
+	}
+
+	return
+}
+
+// fromBolt will copy the contents of a Bolt database into the database
+func fromBolt(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	var (
+		opts migrate.Opts
+		bdb  *bolt.DB
+		n    int
+	)
+
+	if opts, err = migrateOpts(); err != nil {
+		return
+	}
+
+	if bdb, err = bolt.Open(args[0], 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second}); err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	if n, err = migrate.FromBolt(db, bdb, opts); err != nil {
+		return
+	}
+
+	_, err = fmt.Fprintln(out, "copied", n, "keys")
+	return
+}
+
+// toBolt will copy the contents of the database into a Bolt database
+func toBolt(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	var (
+		opts migrate.Opts
+		bdb  *bolt.DB
+		n    int
+	)
+
+	if opts, err = migrateOpts(); err != nil {
+		return
+	}
+
+	if bdb, err = bolt.Open(args[0], 0600, &bolt.Options{Timeout: time.Second}); err != nil {
+		return
+	}
+
+	if n, err = migrate.ToBolt(bdb, db, opts); err == nil {
+		_, err = fmt.Fprintln(out, "copied", n, "keys")
+	}
+
+	if cerr := bdb.Close(); err == nil {
+		err = cerr
+	}
+
+	return
+}
+
+// migrateOpts will return migration options for the provided flags
+func migrateOpts() (opts migrate.Opts, err error) {
+	switch *mapping {
+	case "prefix":
+		opts.Mapping = migrate.MapPrefix
+	case "bucket":
+		opts.Mapping = migrate.MapBucket
+	default:
+		err = errMapping
+		return
+	}
+
+	opts.Separator = *separator
+	opts.RootBucket = *rootBucket
+	return
+}
+
+// shell will execute commands read from stdin, one per line. Errors are reported and do not end the shell.
+// The value of put is the remainder of the line following the key
+func shell(db *hippy.Hippy, args []string, out io.Writer) (err error) {
+	var (
+		s   = bufio.NewScanner(os.Stdin)
+		tty = isTerminal(os.Stdin)
+	)
+
+	s.Buffer(nil, 64*1024*1024)
+	for prompt(tty); s.Scan(); prompt(tty) {
+		line := strings.TrimSpace(s.Text())
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "exit" || fields[0] == "quit":
+			return
+		case fields[0] == "help":
+			for _, name := range commandNames() {
+				fmt.Fprintln(out, commands[name].usage)
+			}
+
+			continue
+		case fields[0] == "shell":
+			fmt.Fprintln(os.Stderr, "error:", errNestedShell)
+			continue
+		case fields[0] == "put" && len(fields) > 1:
+			// Values may contain spaces, the value is everything following the key. Stdin is our input, so a missing
+			// value is empty rather than read from stdin
+			key := fields[1]
+			val := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[len("put"):]), key))
+			fields = []string{"put", key, val}
+		}
+
+		if err = exec(db, fields, out); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+
+	return s.Err()
+}
+
+// prompt will write our prompt to stderr when reading from a terminal, keeping stdout clean for scripts
+func prompt(tty bool) {
+	if tty {
+		fmt.Fprint(os.Stderr, "hippy> ")
+	}
+}
+
+// isTerminal will return whether or not a file is a character device, such as a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,110 @@
+// hippyd serves a Hippy database over TCP, see the server package for the protocol.
+// A Redis compatible listener is also served when -resp is set, see the resp package. Prometheus metrics are served at
+// /metrics when -metrics is set, see the metrics package
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/itsmontoya/hippy/metrics"
+	"github.com/itsmontoya/hippy/resp"
+	"github.com/itsmontoya/hippy/server"
+)
+
+func main() {
+	var (
+		path   = flag.String("path", ".", "directory containing the database")
+		name   = flag.String("name", "hippy", "name of the database")
+		addr   = flag.String("addr", "127.0.0.1:5757", "TCP address to listen on")
+		raddr  = flag.String("resp", "", "TCP address to serve the Redis protocol on, disabled when empty")
+		maddr  = flag.String("metrics", "", "HTTP address to serve Prometheus metrics on, disabled when empty")
+		config = flag.String("config", "", "ini file containing database options, default options are used when empty")
+	)
+
+	flag.Parse()
+
+	if err := run(*path, *name, *addr, *raddr, *maddr, *config); err != nil {
+		fmt.Fprintln(os.Stderr, "hippyd:", err)
+		os.Exit(1)
+	}
+}
+
+// run will serve the database until we receive an interrupt or termination signal
+func run(path, name, addr, raddr, maddr, config string) (err error) {
+	var (
+		opts hippy.Opts
+		db   *hippy.Hippy
+		src  interface{}
+	)
+
+	if len(config) > 0 {
+		src = config
+	}
+
+	if opts, err = hippy.NewOpts(src); err != nil {
+		return
+	}
+
+	if db, err = hippy.New(path, name, opts); err != nil {
+		return
+	}
+
+	var (
+		srvs []closer
+		errs hippy.ErrorList
+	)
+
+	// Buffered so that servers which return after we have stopped listening do not block
+	done := make(chan error, 3)
+
+	srv := server.New(db)
+	srvs = append(srvs, srv)
+	go func() { done <- srv.ListenAndServe(addr) }()
+
+	if len(raddr) > 0 {
+		rsrv := resp.New(db)
+		srvs = append(srvs, rsrv)
+		go func() { done <- rsrv.ListenAndServe(raddr) }()
+	}
+
+	if len(maddr) > 0 {
+		mh := metrics.New()
+		mh.Register(name, db)
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", mh)
+
+		msrv := &http.Server{Addr: maddr, Handler: mux}
+		srvs = append(srvs, msrv)
+		go func() { done <- msrv.ListenAndServe() }()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-done:
+		// A server has failed, the remaining servers are stopped below
+		errs.Push(err)
+	case <-sig:
+	}
+
+	for _, s := range srvs {
+		// Servers which have already stopped listening are still closed to release their connections
+		errs.Push(s.Close())
+	}
+
+	errs.Push(db.Close())
+	return errs.Err()
+}
+
+// closer is a server which can be closed
+type closer interface {
+	Close() error
+}
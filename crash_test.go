@@ -0,0 +1,504 @@
+package hippy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itsmontoya/lineFile"
+)
+
+const (
+	crashSeed       = 1   // Seed used for our randomized workloads
+	crashIterations = 300 // Number of workloads to run
+	crashOps        = 40  // Maximum number of operations per workload
+	crashBucket     = "bucket"
+)
+
+// crashKeys are the keys modified by our workloads
+var crashKeys = []string{"a", "b", "c", "d", "e", "f"}
+
+// crashState is the expected contents of a database, bucket keys are prefixed by their bucket name and a null byte
+type crashState map[string]string
+
+// clone will return a copy of the state
+func (cs crashState) clone() (out crashState) {
+	out = make(crashState, len(cs))
+	for k, v := range cs {
+		out[k] = v
+	}
+
+	return
+}
+
+// equal will return whether or not the provided state is equal to ours
+func (cs crashState) equal(b crashState) bool {
+	if len(cs) != len(b) {
+		return false
+	}
+
+	for k, v := range cs {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestCrashConsistency(t *testing.T) {
+	rnd := rand.New(rand.NewSource(crashSeed))
+	for i := 0; i < crashIterations; i++ {
+		runCrashWorkload(t, rnd, i)
+	}
+}
+
+// runCrashWorkload will run a random workload until a fault occurs or our operations are exhausted, and then simulate a crash.
+// The recovered database must equal the state of our last acknowledged commit, or the commit which was in-flight during the crash
+func runCrashWorkload(t *testing.T, rnd *rand.Rand, iter int) {
+	var (
+		db  *Hippy
+		err error
+	)
+
+	lb := NewFaultBackend()
+	ab := NewFaultBackend()
+
+	copts := opts
+	copts.LogBackend = lb
+	copts.ArchiveBackend = ab
+	copts.ReapInterval = 0
+
+	states := []crashState{{}} // Committed states, the final state may be in-flight
+	acked := 0                 // Index of our last acknowledged state
+
+	if db, err = New("", "crash_test", copts); err != nil {
+		t.Fatalf("iteration %d: error opening: %v", iter, err)
+	}
+
+	lb.FailAfter(rnd.Intn(crashOps * 4))
+	if rnd.Intn(2) == 0 {
+		ab.FailAfter(rnd.Intn(crashOps))
+	}
+
+	for op := 0; op < crashOps; op++ {
+		if rnd.Intn(10) == 0 {
+			// Close will archive and compact
+			if err = db.Close(); err != nil {
+				break
+			}
+
+			if db, err = New("", "crash_test", copts); err != nil {
+				t.Fatalf("iteration %d: error re-opening: %v", iter, err)
+			}
+
+			checkCrashState(t, iter, db, states[acked])
+			continue
+		}
+
+		next, fn := newCrashTx(rnd, states[acked])
+		states = append(states[:acked+1], next)
+		if err = db.Write(fn); err == nil {
+			acked++
+			continue
+		}
+
+		if rnd.Intn(2) == 0 {
+			// Crash with our failed transaction in-flight
+			break
+		}
+
+		// Recover from our failed transaction without crashing, it must never become visible
+		lb.FailAfter(-1)
+		ab.FailAfter(-1)
+		states = states[:acked+1]
+		checkCrashState(t, iter, db, states[acked])
+	}
+
+	// Our previous instance is abandoned, as though our process had crashed
+	lb.Crash(rnd.Intn(4), rnd.Intn(2) == 0)
+	ab.Crash(rnd.Intn(4), rnd.Intn(2) == 0)
+
+	if db, err = New("", "crash_test", copts); err != nil {
+		t.Fatalf("iteration %d: error recovering: %v", iter, err)
+	}
+
+	recovered := readCrashState(t, db)
+	if !recovered.equal(states[acked]) && (len(states) == acked+1 || !recovered.equal(states[acked+1])) {
+		t.Fatalf("iteration %d: recovered state %v does not match acknowledged state %v", iter, recovered, states[acked])
+	}
+
+	// Our recovered database must remain writable and durable
+	next, fn := newCrashTx(rnd, recovered)
+	if err = db.Write(fn); err != nil {
+		t.Fatalf("iteration %d: error writing after recovery: %v", iter, err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatalf("iteration %d: error closing after recovery: %v", iter, err)
+	}
+
+	if db, err = New("", "crash_test", copts); err != nil {
+		t.Fatalf("iteration %d: error re-opening after recovery: %v", iter, err)
+	}
+
+	checkCrashState(t, iter, db, next)
+
+	// A torn archive line must have been discarded rather than joined by our next archive
+	for i, l := range ab.Lines(0) {
+		if _, _, err = db.parseLogLine(bytes.NewBuffer(l)); err != nil {
+			t.Fatalf("iteration %d: invalid archive line %d: %v", iter, i, err)
+		}
+	}
+
+	db.Close()
+}
+
+// newCrashTx will return a random write transaction and the state which results from applying it to the provided state
+func newCrashTx(rnd *rand.Rand, cur crashState) (next crashState, fn func(*WriteTx) error) {
+	type crashOp struct {
+		bucket bool
+		drop   bool
+		del    bool
+		key    string
+		val    string
+	}
+
+	var ops []crashOp
+	next = cur.clone()
+	for i, n := 0, 1+rnd.Intn(4); i < n; i++ {
+		op := crashOp{
+			bucket: rnd.Intn(3) == 0,
+			del:    rnd.Intn(3) == 0,
+			key:    crashKeys[rnd.Intn(len(crashKeys))],
+			val:    fmt.Sprintf("%x", rnd.Int63()),
+		}
+
+		if op.bucket && rnd.Intn(8) == 0 {
+			op.drop = true
+		}
+
+		ops = append(ops, op)
+
+		key := op.key
+		if op.bucket {
+			key = crashBucket + "\x00" + key
+		}
+
+		switch {
+		case op.drop:
+			for k := range next {
+				if len(k) > len(crashBucket) && k[:len(crashBucket)+1] == crashBucket+"\x00" {
+					delete(next, k)
+				}
+			}
+		case op.del:
+			delete(next, key)
+		default:
+			next[key] = op.val
+		}
+	}
+
+	fn = func(txn *WriteTx) (err error) {
+		for _, op := range ops {
+			switch {
+			case op.drop:
+				txn.DeleteBucket(crashBucket)
+			case op.bucket && op.del:
+				txn.Bucket(crashBucket).Del(op.key)
+			case op.bucket:
+				err = txn.Bucket(crashBucket).Put(op.key, []byte(op.val))
+			case op.del:
+				txn.Del(op.key)
+			default:
+				err = txn.Put(op.key, []byte(op.val))
+			}
+
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	}
+
+	return
+}
+
+// readCrashState will return the contents of a database
+func readCrashState(t *testing.T, db *Hippy) (cs crashState) {
+	cs = make(crashState)
+	if err := db.Read(func(txn *ReadTx) (err error) {
+		for _, k := range txn.Keys() {
+			v, _ := txn.Get(k)
+			cs[k] = string(v)
+		}
+
+		for _, name := range txn.Buckets() {
+			if err = txn.Bucket(name).ForEach(func(k string, v []byte) error {
+				cs[name+"\x00"+k] = string(v)
+				return nil
+			}); err != nil {
+				return
+			}
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+// checkCrashState will ensure the contents of a database match the expected state
+func checkCrashState(t *testing.T, iter int, db *Hippy, expected crashState) {
+	if cs := readCrashState(t, db); !cs.equal(expected) {
+		t.Fatalf("iteration %d: state %v does not match expected state %v", iter, cs, expected)
+	}
+}
+
+func TestTornLine(t *testing.T) {
+	var (
+		b   []byte
+		ok  bool
+		db  *Hippy
+		f   *os.File
+		err error
+	)
+
+	if db, err = New(tmpPath, "torn_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("greeting", []byte("Hello!"))
+	})
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loc := filepath.Join(tmpPath, "torn_test.hdb")
+	defer os.Remove(loc)
+	defer os.Remove(filepath.Join(tmpPath, "torn_test.archive.hdb"))
+
+	if f, err = os.OpenFile(loc, os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append an uncommitted record followed by a partial line, as though we crashed mid-write
+	var ll []byte
+	if ll, err = newTestLogLine(db, "greeting", []byte("Goodbye!")); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Write(ll)
+	f.Write([]byte{'\n'})
+	f.Write(ll[:len(ll)/2])
+	f.Close()
+
+	if db, err = New(tmpPath, "torn_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("greeting"); !ok || string(b) != "Hello!" {
+			t.Errorf("invalid value: %s", b)
+		}
+		return
+	})
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("name", []byte("Hippy"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "torn_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("greeting"); !ok || string(b) != "Hello!" {
+			t.Errorf("uncommitted record was applied: %s", b)
+		}
+
+		if b, ok = txn.Get("name"); !ok || string(b) != "Hippy" {
+			t.Errorf("invalid value: %s", b)
+		}
+		return
+	})
+
+	db.Close()
+}
+
+func TestReplaceFault(t *testing.T) {
+	var (
+		fb  *fileBackend
+		err error
+
+		errWrite = errors.New("write failed")
+	)
+
+	if fb, err = newFileBackend(lineFile.Opts{Path: tmpPath, Name: "replace_test", Ext: "hdb"}); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(filepath.Join(tmpPath, "replace_test.hdb"))
+	defer fb.Close()
+
+	fb.Append([]byte("a"))
+	fb.Append([]byte("b"))
+	if err = fb.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	replace := func(fail error, lines ...string) error {
+		return fb.Replace(func(write func([]byte) error) (err error) {
+			for _, l := range lines {
+				if err = write([]byte(l)); err != nil {
+					return
+				}
+			}
+
+			return fail
+		})
+	}
+
+	checkLines := func(expected ...string) {
+		var ls []string
+		if err = fb.ReadFrom(0, func(b *bytes.Buffer) bool {
+			ls = append(ls, b.String())
+			return false
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(ls) != fmt.Sprint(expected) {
+			t.Fatalf("expected lines %v and received %v", expected, ls)
+		}
+
+		if _, err = os.Stat(filepath.Join(tmpPath, "replace_test.tmp.hdb")); !os.IsNotExist(err) {
+			t.Fatalf("replacement was left behind: %v", err)
+		}
+	}
+
+	// Fail while writing our replacement
+	if err = replace(errWrite, "c"); err != errWrite {
+		t.Fatalf("expected %v and received %v", errWrite, err)
+	}
+
+	checkLines("a", "b")
+
+	// Fail while renaming our replacement over our file
+	fb.rename = func(string, string) error { return ErrInjectedFault }
+	if err = replace(nil, "d"); err != ErrInjectedFault {
+		t.Fatalf("expected %v and received %v", ErrInjectedFault, err)
+	}
+
+	fb.rename = os.Rename
+	checkLines("a", "b")
+
+	// Our file remains usable, and our failed replacements are not carried into the next
+	fb.Append([]byte("e"))
+	if err = fb.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = replace(nil, "f"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLines("f")
+}
+
+func TestFileTruncate(t *testing.T) {
+	var (
+		fb  *fileBackend
+		fi  os.FileInfo
+		err error
+	)
+
+	lfopts := lineFile.Opts{Path: tmpPath, Name: "truncate_test", Ext: "hdb"}
+	loc := filepath.Join(tmpPath, "truncate_test.hdb")
+	defer os.Remove(loc)
+
+	if fb, err = newFileBackend(lfopts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []string{"a", "bb", "ccc"} {
+		fb.Append([]byte(l))
+	}
+
+	// Our unflushed lines are retained up to the line we truncate at
+	if err = fb.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err = os.Stat(loc); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Size() != 5 {
+		t.Fatalf("expected a size of 5 and received %d", fi.Size())
+	}
+
+	fb.Append([]byte("dddd"))
+	if err = fb.Truncate(10); err != nil {
+		t.Fatal(err)
+	}
+
+	fb.Close()
+
+	// Our offsets are rebuilt when re-opened
+	if fb, err = newFileBackend(lfopts); err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+
+	if err = fb.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if ls, _ := readFileLines(fb); fmt.Sprint(ls) != "[a]" {
+		t.Fatalf("invalid lines: %v", ls)
+	}
+
+	if fi, err = os.Stat(loc); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Size() != 2 {
+		t.Fatalf("expected a size of 2 and received %d", fi.Size())
+	}
+}
+
+// readFileLines will return the lines of a file backend
+func readFileLines(fb *fileBackend) (ls []string, err error) {
+	err = fb.ReadFrom(0, func(b *bytes.Buffer) bool {
+		ls = append(ls, b.String())
+		return false
+	})
+
+	return
+}
+
+// newTestLogLine will return an encoded PUT log line
+func newTestLogLine(db *Hippy, key string, val []byte) (b []byte, err error) {
+	err = db.writeLogLine(func(line []byte) error {
+		b = append([]byte(nil), line...)
+		return nil
+	}, key, action{a: _put, b: val})
+
+	return
+}
@@ -0,0 +1,468 @@
+package hippy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// ErrInvalidFormat is returned when an export or import format is not supported
+	ErrInvalidFormat = errors.Error("invalid format")
+	// ErrInvalidRecord is returned when an imported record is missing it's key or value
+	ErrInvalidRecord = errors.Error("invalid record, key and value are required")
+	// ErrInvalidHeader is returned when a CSV import does not begin with a header containing key and value columns
+	ErrInvalidHeader = errors.Error("invalid header, key and value columns are required")
+)
+
+// DefaultImportBatch is the number of records committed per transaction when ImportOpts.BatchSize is not set
+const DefaultImportBatch = 1000
+
+// Format is an export and import format
+type Format uint8
+
+const (
+	// FormatJSON is JSON Lines, one object per line with base64 encoded values:
+	//	{"bucket":"users","key":"1","value":"SGlwcHk=","expires":"2024-01-02T15:04:05Z"}
+	// Bucket and expires are omitted when not set
+	FormatJSON Format = iota
+	// FormatJSONRaw is JSON Lines with values as strings. Values must be valid UTF-8, use FormatJSON for binary values
+	FormatJSONRaw
+	// FormatCSV is CSV with a header of bucket, key, value and expires. Columns are matched by the header on import,
+	// where only key and value are required. Values containing CRLF line breaks are read back with LF line breaks,
+	// use FormatJSON for binary values
+	FormatCSV
+)
+
+// csvHeader is the header written by a CSV export
+var csvHeader = []string{"bucket", "key", "value", "expires"}
+
+// ImportOpts are options for Import
+type ImportOpts struct {
+	// BatchSize is the number of records committed per Write transaction, DefaultImportBatch is used when zero
+	BatchSize int
+	// StopOnError will stop the import at the first invalid line, batches which have been committed remain
+	StopOnError bool
+}
+
+// exportRecord is a single key within an export
+type exportRecord struct {
+	bucket string
+	key    string
+	value  []byte
+	exp    int64 // Expiry in unix nanoseconds, zero when the key does not expire
+}
+
+// jsonRecord is the JSON representation of an exportRecord
+type jsonRecord struct {
+	Bucket  string          `json:"bucket,omitempty"`
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Expires *time.Time      `json:"expires,omitempty"`
+}
+
+// Export will write the contents of the database to w, root keys are followed by buckets in name order and keys are
+// written in key order. The export is consistent, writers are blocked until it has been written in full
+// Note: A slow writer delays all writes to the database, as with Backup
+func (h *Hippy) Export(w io.Writer, f Format) (err error) {
+	var (
+		write func(*exportRecord) error
+		cw    *csv.Writer
+		bw    = bufio.NewWriter(w)
+	)
+
+	switch f {
+	case FormatJSON, FormatJSONRaw:
+		write = newJSONWriter(bw, f == FormatJSONRaw)
+	case FormatCSV:
+		cw = csv.NewWriter(bw)
+		if err = cw.Write(csvHeader); err != nil {
+			return
+		}
+
+		write = newCSVWriter(cw)
+	default:
+		return ErrInvalidFormat
+	}
+
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	h.mux.RLock()
+	if h.closed {
+		err = ErrIsClosed
+	} else {
+		err = h.export(write)
+	}
+	h.mux.RUnlock()
+
+	if err != nil {
+		return
+	}
+
+	if cw != nil {
+		// Our CSV writer must be flushed prior to our buffered writer
+		if cw.Flush(); cw.Error() != nil {
+			return cw.Error()
+		}
+	}
+
+	return bw.Flush()
+}
+
+// export will call write for every key which has not expired
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) export(write func(*exportRecord) error) (err error) {
+	now := time.Now().UnixNano()
+	for _, k := range sortedKeys(h.s) {
+		if h.isExpired(k, now) {
+			continue
+		}
+
+		if err = write(&exportRecord{key: k, value: h.s[k], exp: h.e[k]}); err != nil {
+			return
+		}
+	}
+
+	names := make([]string, 0, len(h.b))
+	for name := range h.b {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		s := h.b[name]
+		for _, k := range sortedKeys(s) {
+			if err = write(&exportRecord{bucket: name, key: k, value: s[k]}); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// newJSONWriter will return a record writer for JSON Lines
+func newJSONWriter(w *bufio.Writer, raw bool) func(*exportRecord) error {
+	enc := json.NewEncoder(w)
+	// Keys and values are data, they should be written exactly as they are
+	enc.SetEscapeHTML(false)
+	return func(r *exportRecord) (err error) {
+		jr := jsonRecord{Bucket: r.bucket, Key: r.key}
+		if raw {
+			jr.Value, err = marshalJSON(string(r.value))
+		} else {
+			jr.Value, err = marshalJSON(r.value)
+		}
+
+		if err != nil {
+			return
+		}
+
+		if r.exp > 0 {
+			exp := time.Unix(0, r.exp).UTC()
+			jr.Expires = &exp
+		}
+
+		// Encode terminates each record with a newline
+		return enc.Encode(&jr)
+	}
+}
+
+// newCSVWriter will return a record writer for CSV
+func newCSVWriter(w *csv.Writer) func(*exportRecord) error {
+	return func(r *exportRecord) error {
+		var exp string
+		if r.exp > 0 {
+			exp = time.Unix(0, r.exp).UTC().Format(time.RFC3339Nano)
+		}
+
+		return w.Write([]string{r.bucket, r.key, string(r.value), exp})
+	}
+}
+
+// Import will read records written by Export (or any source in the same format) and put them into the database.
+// Records are committed in batches of Write transactions, so an import is not atomic. Invalid lines are skipped and
+// reported as a *LineError within the returned ErrorList, unless opts.StopOnError is set. Records which have expired
+// are skipped. The number of records imported is returned
+func (h *Hippy) Import(r io.Reader, f Format, opts ImportOpts) (n int, err error) {
+	var errs ErrorList
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatch
+	}
+
+	batch := make([]exportRecord, 0, opts.BatchSize)
+	commit := func() (err error) {
+		var put int
+		if len(batch) == 0 {
+			return
+		}
+
+		if err = h.Write(func(txn *WriteTx) (err error) {
+			put, err = putRecords(txn, batch)
+			return
+		}); err == nil {
+			n += put
+		}
+
+		batch = batch[:0]
+		return
+	}
+
+	// Handle every record, invalid records are reported with their line number
+	handle := func(line int, rec exportRecord, rerr error) (err error) {
+		if rerr == nil {
+			rerr = validateRecord(&rec)
+		}
+
+		if rerr != nil {
+			lerr := &LineError{Line: line, Err: rerr}
+			errs.Push(lerr)
+			if opts.StopOnError {
+				return lerr
+			}
+
+			return
+		}
+
+		if batch = append(batch, rec); len(batch) == opts.BatchSize {
+			err = commit()
+		}
+
+		return
+	}
+
+	switch f {
+	case FormatJSON, FormatJSONRaw:
+		err = readJSON(r, f == FormatJSONRaw, handle)
+	case FormatCSV:
+		err = readCSV(r, handle)
+	default:
+		err = ErrInvalidFormat
+	}
+
+	if err == nil {
+		err = commit()
+	}
+
+	if _, ok := err.(*LineError); !ok {
+		// Line errors have already been added to our list
+		errs.Push(err)
+	}
+
+	err = errs.Err()
+	return
+}
+
+// putRecords will put records which have not expired, the number of records put is returned
+func putRecords(txn *WriteTx, rs []exportRecord) (n int, err error) {
+	now := time.Now().UnixNano()
+	for _, r := range rs {
+		switch {
+		case len(r.bucket) > 0:
+			err = txn.Bucket(r.bucket).Put(r.key, r.value)
+		case r.exp == 0 || r.exp > now:
+			// Our expiry is set as-is so that it does not drift
+			err = txn.putWithExpiry(r.key, r.value, r.exp)
+		default:
+			// Record has expired
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		n++
+	}
+
+	return
+}
+
+// validateRecord will ensure a record can be put, so that a single record does not fail an entire batch
+func validateRecord(r *exportRecord) error {
+	switch {
+	case len(r.key) > MaxKeyLen:
+		return ErrInvalidKey
+	case len(r.bucket) > 0 && !isValidBucket(r.bucket):
+		return ErrInvalidBucket
+	case len(r.bucket) > 0 && r.exp > 0:
+		// Bucket keys do not expire, an expiry cannot be honored
+		return ErrInvalidTTL
+	default:
+		return nil
+	}
+}
+
+// readJSON will read JSON Lines records
+func readJSON(r io.Reader, raw bool, fn func(line int, rec exportRecord, err error) error) (err error) {
+	var (
+		b    []byte
+		rerr error
+	)
+
+	br := bufio.NewReader(r)
+	for line := 1; rerr == nil; line++ {
+		if b, rerr = br.ReadBytes('\n'); rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+
+		if b = bytes.TrimSpace(b); len(b) == 0 {
+			continue
+		}
+
+		rec, perr := parseJSONRecord(b, raw)
+		if err = fn(line, rec, perr); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// parseJSONRecord will parse a JSON Lines record
+func parseJSONRecord(b []byte, raw bool) (rec exportRecord, err error) {
+	var jr jsonRecord
+	if err = json.Unmarshal(b, &jr); err != nil {
+		return
+	}
+
+	if len(jr.Key) == 0 || len(jr.Value) == 0 {
+		err = ErrInvalidRecord
+		return
+	}
+
+	rec.bucket = jr.Bucket
+	rec.key = jr.Key
+	if raw {
+		var s string
+		err = json.Unmarshal(jr.Value, &s)
+		rec.value = []byte(s)
+	} else {
+		err = json.Unmarshal(jr.Value, &rec.value)
+	}
+
+	if jr.Expires != nil {
+		rec.exp = jr.Expires.UnixNano()
+	}
+
+	return
+}
+
+// readCSV will read CSV records, the first record must be a header
+func readCSV(r io.Reader, fn func(line int, rec exportRecord, err error) error) (err error) {
+	var (
+		row  []string
+		cols = map[string]int{"bucket": -1, "expires": -1}
+	)
+
+	cr := csv.NewReader(r)
+	// Rows are validated against our header below, so that a short row is reported as a line error
+	cr.FieldsPerRecord = -1
+	if row, err = cr.Read(); err != nil {
+		if err == io.EOF {
+			err = ErrInvalidHeader
+		}
+
+		return
+	}
+
+	for i, name := range row {
+		cols[name] = i
+	}
+
+	if _, ok := cols["key"]; !ok {
+		return ErrInvalidHeader
+	}
+
+	if _, ok := cols["value"]; !ok {
+		return ErrInvalidHeader
+	}
+
+	for {
+		if row, err = cr.Read(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			// Malformed CSV cannot be reliably resumed from
+			return
+		}
+
+		line, _ := cr.FieldPos(0)
+		rec, perr := parseCSVRecord(row, cols)
+		if err = fn(line, rec, perr); err != nil {
+			return
+		}
+	}
+}
+
+// parseCSVRecord will parse a CSV record using the column positions of our header
+func parseCSVRecord(row []string, cols map[string]int) (rec exportRecord, err error) {
+	for _, i := range cols {
+		if i >= len(row) {
+			// Row is shorter than our header
+			err = ErrInvalidRecord
+			return
+		}
+	}
+
+	field := func(name string) string {
+		if i := cols[name]; i >= 0 {
+			return row[i]
+		}
+
+		// Optional column is not present
+		return ""
+	}
+
+	rec.bucket = field("bucket")
+	rec.key = field("key")
+	val, exp := field("value"), field("expires")
+	if len(rec.key) == 0 {
+		err = ErrInvalidRecord
+		return
+	}
+
+	rec.value = []byte(val)
+	if len(exp) > 0 {
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339Nano, exp); err != nil {
+			return
+		}
+
+		rec.exp = t.UnixNano()
+	}
+
+	return
+}
+
+// marshalJSON will marshal a value without escaping HTML characters
+func marshalJSON(v interface{}) (b json.RawMessage, err error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(v); err != nil {
+		return
+	}
+
+	// Remove the trailing newline added by Encode
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// sortedKeys will return the keys of a map in key order
+func sortedKeys(m map[string][]byte) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return
+}
@@ -1,13 +1,32 @@
 package hippy
 
-// action stores the action-type and body for a transaction item
+import (
+	"container/heap"
+	"encoding/binary"
+	"sort"
+)
+
+// action stores the action-type, body, and expiry for a transaction item
 type action struct {
 	a byte
 	b []byte
+	e int64 // Expiry (in unix nanoseconds), zero when the item does not expire
 }
 
 type storage map[string][]byte
 
+// expiries stores the expiry (in unix nanoseconds) by key
+type expiries map[string]int64
+
+// record is a parsed log line
+type record struct {
+	key string
+	act action
+}
+
+// leases stores the leased upper bound by sequence name
+type leases map[string]uint64
+
 // Error is a simple error type which is able to be stored as a const, rather than a global var
 type Error string
 
@@ -69,6 +88,25 @@ func (e ErrorList) Err() error {
 	return e
 }
 
+// EncodeInt64 will encode an integer as an 8 byte, big-endian, two's complement value
+// Note: This is the encoding used by ReadWriteTx.Incr
+func EncodeInt64(n int64) (b []byte) {
+	b = make([]byte, intLen)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return
+}
+
+// DecodeInt64 will decode an integer encoded by EncodeInt64
+func DecodeInt64(b []byte) (n int64, err error) {
+	if len(b) != intLen {
+		err = ErrInvalidInt
+		return
+	}
+
+	n = int64(binary.BigEndian.Uint64(b))
+	return
+}
+
 func reverseByteSlice(bs []byte) {
 	var n int
 	mc := len(bs) - 1
@@ -80,3 +118,37 @@ func reverseByteSlice(bs []byte) {
 		bs[i], bs[n] = bs[n], bs[i]
 	}
 }
+
+// keyHeap is a max-heap of keys, it retains the smallest keys pushed to it
+type keyHeap []string
+
+func (kh keyHeap) Len() int            { return len(kh) }
+func (kh keyHeap) Less(i, j int) bool  { return kh[i] > kh[j] }
+func (kh keyHeap) Swap(i, j int)       { kh[i], kh[j] = kh[j], kh[i] }
+func (kh *keyHeap) Push(x interface{}) { *kh = append(*kh, x.(string)) }
+func (kh *keyHeap) Pop() (x interface{}) {
+	old := *kh
+	x = old[len(old)-1]
+	*kh = old[:len(old)-1]
+	return
+}
+
+// offer will add a key while retaining at most n keys, the largest key is discarded once n is exceeded
+func (kh *keyHeap) offer(k string, n int) {
+	if len(*kh) < n {
+		heap.Push(kh, k)
+		return
+	}
+
+	if k < (*kh)[0] {
+		// Our key is smaller than our largest retained key, replace it
+		(*kh)[0] = k
+		heap.Fix(kh, 0)
+	}
+}
+
+// sorted will return the retained keys in order
+func (kh keyHeap) sorted() []string {
+	sort.Strings(kh)
+	return kh
+}
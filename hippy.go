@@ -2,9 +2,13 @@ package hippy
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"io"
-	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/itsmontoya/lineFile"
 	"github.com/itsmontoya/middleware"
@@ -16,9 +20,17 @@ import (
 const (
 	_none byte = iota
 
-	_put  // Byte representing a PUT action
-	_del  // Byte representing a DELETE action
-	_hash // Hash line
+	_put        // Byte representing a PUT action
+	_del        // Byte representing a DELETE action
+	_hash       // Hash line
+	_putExp     // Byte representing a PUT action with an expiry
+	_lease      // Byte representing a sequence lease
+	_bput       // Byte representing a bucket PUT action
+	_bdel       // Byte representing a bucket DELETE action
+	_bdrop      // Byte representing a bucket DROP action
+	_commit     // Byte representing a transaction commit
+	_           // Skipped, as it is equal to _newline and would split our log line
+	_checkpoint // Byte representing a compaction checkpoint
 
 	_separator = ':'  // Separator used to split key and value
 	_newline   = '\n' // Character for newline
@@ -28,6 +40,13 @@ const (
 	// MaxKeyLen is the maximum length for keys
 	MaxKeyLen = 255
 	hashLen   = 16
+	expLen    = 8 // Length of an encoded expiry
+	intLen    = 8 // Length of an encoded integer
+)
+
+const (
+	minLockBackoff = time.Microsecond * 50 // Initial wait between attempts to acquire a contended lock with a context
+	maxLockBackoff = time.Millisecond * 5  // Maximum wait between attempts to acquire a contended lock with a context
 )
 
 const (
@@ -54,8 +73,40 @@ const (
 
 	// ErrNoChanges is returned when no changes occur and an archive is not needed
 	ErrNoChanges = errors.Error("no changes occured, archive not necessary")
+
+	// ErrInvalidTTL is returned when a non-positive TTL is provided
+	ErrInvalidTTL = errors.Error("invalid ttl, must be greater than zero")
+
+	// ErrInvalidLogLine is returned when a log line is too short to contain it's encoded fields
+	ErrInvalidLogLine = errors.Error("invalid log line")
+
+	// ErrInvalidInt is returned when a value is not a valid encoded integer
+	ErrInvalidInt = errors.Error("invalid integer, value must be 8 bytes")
+
+	// ErrInvalidBucket is returned when an invalid bucket name is provided
+	ErrInvalidBucket = errors.Error("invalid bucket name")
+
+	// ErrReadOnly is returned when a write is attempted on a read-only instance
+	ErrReadOnly = errors.Error("cannot perform write on read-only instance")
+
+	// ErrInMemory is returned when an action which requires backing files is attempted on an in-memory instance
+	ErrInMemory = errors.Error("cannot perform action on in-memory instance")
+
+	// ErrLSNUnavailable is returned when the changes following a log sequence number are no longer available
+	ErrLSNUnavailable = errors.Error("changes for log sequence number are no longer available")
 )
 
+// LineError is an error for a single line of a log being replayed, or of an import. Line numbers begin at one
+type LineError struct {
+	Line int
+	Err  error
+}
+
+// Error is the error interface implementation
+func (e *LineError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
 var (
 	// Hippy-global buffer pool
 	// Note: This might end up in the hippy struct, still deciding what will be the best solution
@@ -71,36 +122,52 @@ func New(path, name string, opts Opts, mws ...middleware.Middleware) (h *Hippy,
 	hip := Hippy{
 		// Make the internal storage map, it would be a shame to panic on put!
 		s:    make(storage),
+		e:    make(expiries),
+		seqs: make(leases),
+		b:    make(buckets),
+		idx:  make(map[string]*index, len(opts.Indexes)),
 		path: path,
 		name: name,
 		mws:  middleware.NewMWs(mws...),
 		opts: opts,
+		w: watchers{
+			policy: opts.WatchPolicy,
+			buffer: opts.WatchBuffer,
+		},
+		cc:  make(chan struct{}),
+		ro:  opts.ReadOnly,
+		st:  new(stats),
+		log: opts.Logger,
 	}
 
-	// Open persistance file
-	lfopts := lineFile.Opts{
-		Path: path,
-		Name: name,
-		Ext:  "hdb",
+	if hip.log == nil {
+		hip.log = nopLogger{}
 	}
 
-	if opts.AsyncBackend {
-		lfopts.Backend = lineFile.AsyncBackend
-	}
+	if !opts.ReadOnly && !opts.InMemory && opts.LogBackend == nil {
+		// Acquire our inter-process lock, read-only instances do not write unless they Follow a leader, which acquires it
+		if hip.lk, err = newFileLock(path, name, opts.LockTimeout); err != nil {
+			return
+		}
 
-	if hip.f, err = lineFile.New(lfopts); err != nil {
-		return
+		defer func() {
+			if err != nil {
+				// We failed to open, release our lock so that we can be opened again
+				hip.lk.release()
+			}
+		}()
 	}
 
-	lfopts.Name = name + ".archive"
-	if hip.af, err = lineFile.New(lfopts); err != nil {
-		return
+	for name, fn := range opts.Indexes {
+		// Create index, it will be populated as our data is replayed
+		hip.idx[name] = newIndex(fn)
 	}
 
-	lfopts.Name = name + ".tmp"
-	lfopts.NoSet = true
-	if hip.tf, err = lineFile.New(lfopts); err != nil {
-		return
+	if !opts.InMemory {
+		// Open persistance backends
+		if err = hip.openBackends(); err != nil {
+			return
+		}
 	}
 
 	h = &hip
@@ -109,8 +176,24 @@ func New(path, name string, opts Opts, mws ...middleware.Middleware) (h *Hippy,
 	h.wtxp = sync.Pool{New: func() interface{} { return h.newWriteTx() }}
 	h.rwtxp = sync.Pool{New: func() interface{} { return h.newReadWriteTx() }}
 
-	// Replay file data to populate the database
-	err = h.replay()
+	if !opts.InMemory {
+		// Replay file data to populate the database
+		if err = h.replay(); err != nil {
+			return
+		}
+
+		// Discard any partial copy left within our archive, read-only instances do not modify their archive
+		if err = h.repairArchive(); err != nil {
+			return
+		}
+	}
+
+	if opts.ReapInterval > 0 && !opts.ReadOnly {
+		// Initialize reaper stop channel and start the expiry reaper
+		h.rs = make(chan struct{})
+		go h.reap(opts.ReapInterval)
+	}
+
 	return
 }
 
@@ -122,28 +205,85 @@ type Hippy struct {
 	name string // Database name
 	opts Opts   // Options
 
-	s   storage         // In-memory storage
-	mws *middleware.MWs // Middlewares
+	s    storage           // In-memory storage
+	e    expiries          // In-memory key expiries
+	seqs leases            // In-memory sequence leases
+	b    buckets           // In-memory bucket storage
+	idx  map[string]*index // In-memory secondary indexes
+	mws  *middleware.MWs   // Middlewares
+
+	f  Backend   // Persistent storage
+	af Backend   // Archive
+	lk *fileLock // Inter-process lock
 
-	f  *lineFile.File // Persistent storage
-	af *lineFile.File // Archive file
-	tf *lineFile.File // Temporary file
+	end     int  // Line index following the last complete write to our log
+	pending int  // Lines written to our log since our last flush
+	dirty   bool // Dirty state, set when our log contains lines which have not been flushed
+	gen     int  // Log generation, incremented whenever our log is replaced. Line indexes do not carry across generations
+
+	st  *stats // Runtime statistics
+	log Logger // Logger, messages are discarded when a logger is not provided
 
 	rtxp  sync.Pool // Read transaction pool
 	wtxp  sync.Pool // Write transaction pool
 	rwtxp sync.Pool // Read/Write transaction pool
 
-	closed bool // Closed state
+	rs  chan struct{} // Reaper stop channel
+	w   watchers      // Change watchers
+	seq uint64        // Log sequence number of the last commit
+	cc  chan struct{} // Commit channel, closed and replaced on every commit and lease
+
+	gate    sync.RWMutex // Transaction gate, held for reading by in-flight transactions
+	closing int32        // Closing state, set atomically once shutdown begins
+	ro      bool         // Read-only state
+	closed  bool         // Closed state
+}
+
+// openBackends will open our log and archive backends, file backends are opened for any backends which were not provided
+func (h *Hippy) openBackends() (err error) {
+	lfopts := lineFile.Opts{
+		Path: h.path,
+		Name: h.name,
+		Ext:  "hdb",
+	}
+
+	if h.opts.AsyncBackend {
+		lfopts.Backend = lineFile.AsyncBackend
+	}
+
+	if h.f = h.opts.LogBackend; h.f == nil {
+		if h.f, err = newFileBackend(lfopts); err != nil {
+			return
+		}
+	}
+
+	if h.af = h.opts.ArchiveBackend; h.af == nil {
+		lfopts.Name = h.name + ".archive"
+		if h.af, err = newFileBackend(lfopts); err != nil {
+			return
+		}
+	}
+
+	return
 }
 
-// newLogLine will return a new log line given a provided key, action, and body
-func (h *Hippy) newLogLine(a byte, key string, b []byte) (out *bytes.Buffer, err error) {
-	var mw *middleware.Writer
+// newLogLine will return a new log line given a provided key and action
+func (h *Hippy) newLogLine(key string, act action) (out *bytes.Buffer, err error) {
+	var (
+		mw  *middleware.Writer
+		exp [expLen]byte
+	)
+
 	// Get buffer from the buffer pool
 	out = bp.Get()
 
+	// PUT actions with an expiry are persisted with their own action byte
+	if act.a == _put && act.e > 0 {
+		act.a = _putExp
+	}
+
 	// Write action
-	if err = out.WriteByte(byte(a)); err != nil {
+	if err = out.WriteByte(act.a); err != nil {
 		goto ERROR
 	}
 
@@ -162,13 +302,22 @@ func (h *Hippy) newLogLine(a byte, key string, b []byte) (out *bytes.Buffer, err
 		goto ERROR
 	}
 
-	// If the action is not PUT, return
-	if a != _put {
+	switch act.a {
+	case _put, _lease, _bput, _bdel, _commit, _checkpoint:
+	case _putExp:
+		// Write expiry ahead of the body
+		binary.BigEndian.PutUint64(exp[:], uint64(act.e))
+		if _, err = mw.Write(exp[:]); err != nil {
+			goto ERROR
+		}
+
+	default:
+		// The action has no body, return
 		goto END
 	}
 
 	// Write body
-	if _, err = mw.Write(b); err != nil {
+	if _, err = mw.Write(act.b); err != nil {
 		goto ERROR
 	}
 
@@ -182,26 +331,26 @@ ERROR:
 	}
 
 	bp.Put(out)
-	bp = nil
+	out = nil
 	return
 }
 
-// parseLogLine will return an action, key, and body from a provided log line (in the form of a byte slice)
-func (h *Hippy) parseLogLine(in *bytes.Buffer) (a byte, key string, body []byte, err error) {
+// parseLogLine will return a key and action from a provided log line (in the form of a byte slice)
+func (h *Hippy) parseLogLine(in *bytes.Buffer) (key string, act action, err error) {
 	var (
 		b   []byte
-		i   uint8
-		kl  uint8 // Key length
+		i   int
+		kl  int // Key length
 		rdr *middleware.Reader
 	)
 
-	if a, err = in.ReadByte(); err != nil {
+	if act.a, err = in.ReadByte(); err != nil {
 		return
 	}
 
 	// Validate action
-	switch a {
-	case _put, _del, _hash:
+	switch act.a {
+	case _put, _del, _hash, _putExp, _lease, _bput, _bdel, _bdrop, _commit, _checkpoint:
 	default:
 		// Invalid action, return ErrInvalidAction
 		err = ErrInvalidAction
@@ -218,20 +367,43 @@ func (h *Hippy) parseLogLine(in *bytes.Buffer) (a byte, key string, body []byte,
 	}
 
 	b = buf.Bytes()
-	kl = uint8(b[i])
+	if len(b) == 0 {
+		err = ErrInvalidLogLine
+		goto END
+	}
+
+	kl = int(b[i])
 	i++
 
+	if len(b) < i+kl {
+		err = ErrInvalidLogLine
+		goto END
+	}
+
 	key = string(b[i : i+kl])
 	i += kl
 
-	// If our action is not PUT, we do not need to parse any further
-	if a != _put {
+	switch act.a {
+	case _put, _lease, _bput, _bdel, _commit, _checkpoint:
+	case _putExp:
+		if len(b) < i+expLen {
+			err = ErrInvalidLogLine
+			goto END
+		}
+
+		// Parse expiry and set our action back to a standard PUT
+		act.e = int64(binary.BigEndian.Uint64(b[i : i+expLen]))
+		act.a = _put
+		i += expLen
+
+	default:
+		// If our action has no body, we do not need to parse any further
 		goto END
 	}
 
 	b = b[i:]
-	body = make([]byte, len(b))
-	copy(body, b)
+	act.b = make([]byte, len(b))
+	copy(act.b, b)
 
 END:
 	rdr.Close()
@@ -241,280 +413,853 @@ END:
 
 func (h *Hippy) replay() (err error) {
 	var (
-		a   byte
-		key string
-		val []byte
-		de  bool // Data exists boolean
+		key  string
+		act  action
+		lsn  int64
+		li   int      // Line index
+		end  int      // Line index following our last complete write
+		rs   []record // Records for the current transaction
+		sc   bool     // Seen commit boolean
+		lerr error    // Invalid line error, only tolerated for our final line as it may have been torn by a crash
 	)
 
+	start := time.Now()
 	h.mux.Lock()
-	h.f.SeekToStart()
-	h.f.ReadLines(func(b *bytes.Buffer) (ok bool) {
-		if a, key, val, err = h.parseLogLine(b); err != nil {
-			return ok
+	rerr := h.f.ReadFrom(0, func(b *bytes.Buffer) (ok bool) {
+		if lerr != nil {
+			// Our invalid line was not our final line, our log is corrupt
+			err = &LineError{Line: li, Err: lerr}
+			return true
+		}
+
+		li++
+		if key, act, lerr = h.parseLogLine(b); lerr != nil {
+			return
 		}
 
 		// Fulfill action
-		switch a {
-		case _hash:
-		case _put:
-			// Put value by key
-			h.s[key] = val
-		case _del:
-			// Delete by key
-			delete(h.s, key)
-		default:
+		switch act.a {
+		case _put, _del, _bput, _bdel, _bdrop:
+			// Transaction records are not applied until their commit is reached
+			rs = append(rs, record{key: key, act: act})
 			return
+		case _commit, _checkpoint:
+			if lsn, lerr = DecodeInt64(act.b); lerr != nil {
+				return
+			}
+
+			if err = h.applyRecords(rs); err != nil {
+				err = &LineError{Line: li, Err: err}
+				return true
+			}
+
+			if act.a == _checkpoint {
+				// Our log was compacted, the records preceding our checkpoint are it's contents
+				h.st.records = 0
+			} else {
+				h.st.records += len(rs)
+			}
+
+			h.seq = uint64(lsn)
+			rs = rs[:0]
+			sc = true
+		case _lease:
+			if lerr = h.applyLease(key, act.b); lerr != nil {
+				return
+			}
+		}
+
+		if len(rs) == 0 {
+			// Hash lines and leases are complete writes when they do not interrupt a transaction
+			end = li
 		}
 
-		// We know data exists, let's set de to true
-		de = true
 		return
 	})
 
-	if err == nil && !de {
-		h.newHashLine(h.f, "")
+	if err == nil {
+		err = rerr
+	}
+
+	if err != nil {
+		goto END
+	}
+
+	if !sc {
+		// Our log pre-dates commit records, apply all of our remaining records
+		if end = li; lerr != nil {
+			end--
+		}
+
+		if err = h.applyRecords(rs); err != nil {
+			goto END
+		}
+
+		h.st.records += len(rs)
+	} else if len(rs) > 0 {
+		h.log.Warn("log ends with an uncommitted transaction", "records", len(rs), "seq", h.seq)
+	}
+
+	if lerr != nil {
+		h.log.Warn("log ends with an invalid line", "line", li, "err", lerr)
+	}
+
+	h.end = end
+	if h.ro {
+		// We do not modify our log while read-only, any lines we would have discarded are removed prior to following a leader
+		h.dirty = end < li
+		goto END
+	}
+
+	if end < li {
+		// Discard our torn line and the records of any transaction which was never committed
+		if err = h.f.Truncate(end); err != nil {
+			goto END
+		}
+	}
+
+	if end == 0 {
+		// Our log is new, mark it as containing commit records by starting with a checkpoint
+		if err = h.newCommitLine(h.writeLine, _checkpoint, 0); err != nil {
+			goto END
+		}
+
+		if err = h.newHashLine(h.writeLine, ""); err != nil {
+			goto END
+		}
+
+		err = h.flush()
+	}
+
+END:
+	if err != nil {
+		h.log.Error("replay failed", "line", li, "err", err)
+	} else {
+		h.log.Debug("replayed log", "lines", li, "seq", h.seq, "duration", time.Since(start))
 	}
 
 	h.mux.Unlock()
 	return
 }
 
-func (h *Hippy) newHashLine(tgt *lineFile.File, hash string) (err error) {
-	var b *bytes.Buffer
-	if len(hash) == 0 {
-		hash = uuid.New().String()
+// applyRecords will fulfill a set of parsed log records against the in-memory storage
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) applyRecords(rs []record) (err error) {
+	for _, r := range rs {
+		switch r.act.a {
+		case _put, _del:
+			h.apply(r.key, r.act)
+		case _bput, _bdel, _bdrop:
+			if err = h.applyBucketLine(r.key, r.act); err != nil {
+				return
+			}
+		}
 	}
 
-	if b, err = h.newLogLine(_hash, hash, nil); err != nil {
-		return
+	return
+}
+
+// newCommitLine will write a commit or checkpoint line for the provided log sequence number
+func (h *Hippy) newCommitLine(fn func([]byte) error, a byte, lsn uint64) (err error) {
+	return h.writeLogLine(fn, "", action{a: a, b: EncodeInt64(int64(lsn))})
+}
+
+func (h *Hippy) newHashLine(fn func([]byte) error, hash string) (err error) {
+	if len(hash) == 0 {
+		hash = uuid.New().String()
 	}
 
-	err = tgt.WriteLine(b.Bytes())
-	bp.Put(b)
-	return
+	return h.writeLogLine(fn, hash, action{a: _hash})
 }
 
 // write will write a transaction to disk
 // Note: This is not thread safe. It is expected that the calling function is managing locks
-func (h *Hippy) write(a map[string]action) (err error) {
-	var ll *bytes.Buffer
-	for k, v := range a {
-		if ll, err = h.newLogLine(v.a, k, v.b); err != nil {
+func (h *Hippy) write(a map[string]action, b bucketChanges) (err error) {
+	var es []Event
+	if len(a) == 0 && len(b) == 0 {
+		// No changes occurred, we have nothing to commit
+		return
+	}
+
+	if h.hasTracers() {
+		start := time.Now()
+		defer func() {
+			h.trace(Trace{Op: TraceCommit, Writable: true, Seq: h.seq, Duration: time.Since(start), Keys: changeCount(a, b), Err: err})
+		}()
+	}
+
+	if h.hasHooks() {
+		es = newEvents(h.seq+1, a, b)
+		// Allow our pre-commit hooks to reject the transaction before we touch disk
+		if err = h.preCommit(es); err != nil {
+			h.st.failed++
 			return
 		}
+	}
 
+	if !h.opts.InMemory {
 		// We are going to write before modifying memory
-		if err = h.f.WriteLine(ll.Bytes()); err != nil {
+		if err = h.writeLog(a, b); err != nil {
+			h.st.failed++
 			return
 		}
+	}
 
-		bp.Put(ll)
-		ll = nil
+	for name, ba := range b {
+		// Fulfill bucket actions
+		h.applyBucketActions(name, ba)
+	}
 
+	for k, v := range a {
 		// Fulfill action
-		switch v.a {
-		case _put:
-			// Put by key
-			h.s[k] = v.b
-		case _del:
-			// Delete by key
-			delete(h.s, k)
-		}
+		h.apply(k, v)
 	}
 
-	return h.f.Flush()
-}
+	h.commit(h.seq + 1)
+	h.st.commits++
+	// Notify watchers of our committed changes
+	h.w.notify(h.seq, a, b)
 
-func (h *Hippy) seekToLastHash(tgt *lineFile.File) (err error) {
-	var pos int // Hash position
-	if pos, _, err = h.getLastHash(tgt); err != nil {
-		return
+	if es != nil {
+		h.postCommit(Commit{LSN: h.seq, Events: es})
 	}
 
-	err = tgt.SeekToLine(pos)
 	return
 }
 
-func (h *Hippy) seekToHash(tgt *lineFile.File, hash string) (err error) {
-	var (
-		li  int // Line index
-		key string
-		pos = -1
-	)
-
-	if err = tgt.SeekToStart(); err != nil {
+// writeLog will write the log lines of a transaction, followed by it's commit line, and flush
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) writeLog(a map[string]action, b bucketChanges) (err error) {
+	if err = h.rollback(); err != nil {
 		return
 	}
 
-	tgt.ReadLines(func(b *bytes.Buffer) (ok bool) {
-		if bb := b.Bytes(); len(bb) == 0 {
+	for name, ba := range b {
+		if err = h.writeBucket(name, ba); err != nil {
 			return
-		} else if bb[0] == _hash {
-			if _, key, _, err = h.parseLogLine(b); err != nil {
-				ok = true
-				return
-			}
+		}
+	}
 
-			if key == hash || len(hash) == 0 {
-				pos = li
-				ok = true
-			}
+	for k, v := range a {
+		if err = h.writeLogLine(h.writeLine, k, v); err != nil {
+			return
 		}
+	}
 
-		li++
+	if err = h.newCommitLine(h.writeLine, _commit, h.seq+1); err != nil {
 		return
-	})
+	}
 
-	if err != nil {
+	// Every line other than our commit line is a record
+	records := h.pending - 1
+	if err = h.flush(); err != nil {
 		return
 	}
 
-	if pos == -1 {
-		err = ErrHashNotFound
-	} else {
-		err = tgt.SeekToLine(pos)
-	}
+	h.st.records += records
 	return
 }
 
-func (h *Hippy) getLastHash(tgt *lineFile.File) (pos int, hash string, err error) {
-	var li int // Line index
-	pos = -1
-	if err = tgt.SeekToStart(); err != nil {
+// writeLine will append a line to our log, the line is not complete until flush is called
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) writeLine(line []byte) (err error) {
+	h.dirty = true
+	if err = h.f.Append(line); err != nil {
 		return
 	}
 
-	tgt.ReadLines(func(b *bytes.Buffer) (ok bool) {
-		bb := b.Bytes()
-		if bb[0] == _hash {
-			pos = li
-			if _, hash, _, err = h.parseLogLine(b); err != nil {
-				ok = true
-				return
-			}
-		}
+	h.pending++
+	// Account for our line and it's trailing newline
+	h.st.bytesWritten += int64(len(line) + 1)
+	return
+}
 
-		li++
+// flush will flush our log, completing all lines written since our last flush
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) flush() (err error) {
+	start := time.Now()
+	if err = h.f.Flush(); err != nil {
 		return
-	})
+	}
 
-	if err == nil && pos == -1 {
-		err = ErrHashNotFound
+	d := time.Since(start)
+	h.st.flush.observe(d)
+	if h.hasTracers() {
+		h.trace(Trace{Op: TraceFlush, Seq: h.seq, Duration: d, Lines: h.pending})
 	}
+
+	h.end += h.pending
+	h.pending = 0
+	h.dirty = false
 	return
 }
 
-func (h *Hippy) getArchivePoint() (hash string, err error) {
-	if _, hash, err = h.getLastHash(h.af); err != nil && err != ErrHashNotFound {
+// rollback will truncate any lines written to our log since our last flush, such as those of a transaction which failed
+// to write. The lines would otherwise be completed by our next flush
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) rollback() (err error) {
+	if !h.dirty {
 		return
 	}
 
-	if err = h.seekToHash(h.f, hash); err != nil {
+	if err = h.f.Truncate(h.end); err != nil {
 		return
 	}
 
-	if err = h.f.NextLine(); err != nil {
-		err = ErrNoChanges
-	}
-
+	h.pending = 0
+	h.dirty = false
 	return
 }
 
-func (h *Hippy) archive() (err error) {
-	if err = h.f.Flush(); err != nil {
+// writeLogLine will pass a new log line for the provided key and action to the provided func
+func (h *Hippy) writeLogLine(fn func([]byte) error, key string, act action) (err error) {
+	var ll *bytes.Buffer
+	if ll, err = h.newLogLine(key, act); err != nil {
 		return
 	}
 
-	var hash string
-	if hash, err = h.getArchivePoint(); err != nil {
-		return
-	}
+	err = fn(ll.Bytes())
+	bp.Put(ll)
+	return
+}
 
-	if err = h.f.SeekToEnd(); err != nil {
-		return
-	}
+// commit will set the log sequence number of our last commit and wake anyone waiting on the next commit
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) commit(lsn uint64) {
+	h.seq = lsn
+	h.wake()
+}
 
-	if err = h.newHashLine(h.f, ""); err != nil {
-		return
-	}
+// wake will close and replace our commit channel, waking anything waiting on our next write
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) wake() {
+	close(h.cc)
+	h.cc = make(chan struct{})
+}
 
-	if err = h.f.Flush(); err != nil {
-		return
+// writeBucket will write the pending actions for a bucket to disk
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) writeBucket(name string, ba *bucketActions) (err error) {
+	if ba.drop {
+		if err = h.writeLogLine(h.writeLine, name, action{a: _bdrop}); err != nil {
+			return
+		}
 	}
 
-	if err = h.seekToHash(h.f, hash); err != nil {
-		return
+	for k, v := range ba.a {
+		if err = h.writeLogLine(h.writeLine, name, newBucketAction(k, v)); err != nil {
+			return
+		}
 	}
 
-	if err = h.f.NextLine(); err != nil {
-		return
+	return
+}
+
+// applyBucketActions will fulfill the pending actions for a bucket against the in-memory storage
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) applyBucketActions(name string, ba *bucketActions) {
+	if ba.drop {
+		h.dropBucket(name)
 	}
 
-	if err = h.af.SeekToEnd(); err != nil {
-		return
+	for k, v := range ba.a {
+		h.applyBucket(name, k, v)
 	}
+}
 
-	if err = h.af.Append(h.f); err != nil {
-		return
+// newBucketAction will return the bucket log action for a provided key and action
+func newBucketAction(k string, v action) action {
+	if v.a == _put {
+		return action{a: _bput, b: newBucketBody(k, v.b)}
 	}
 
-	return h.af.Flush()
+	return action{a: _bdel, b: newBucketBody(k, nil)}
 }
 
-func (h *Hippy) compact() (err error) {
+// applyBucketLine will fulfill a parsed bucket log line against the in-memory storage
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) applyBucketLine(name string, act action) (err error) {
 	var (
-		hash string
-		ll   *bytes.Buffer
+		key string
+		val []byte
 	)
 
-	if _, hash, err = h.getLastHash(h.f); err != nil {
+	if act.a == _bdrop {
+		h.dropBucket(name)
 		return
 	}
 
-	if err = h.tf.Open(); err != nil {
+	if key, val, err = parseBucketBody(act.b); err != nil {
 		return
 	}
 
-	// Write data contents to tmp file
-	for k, v := range h.s {
-		if ll, err = h.newLogLine(_put, k, v); err != nil {
-			goto ITEREND
+	if act.a == _bput {
+		h.applyBucket(name, key, action{a: _put, b: val})
+	} else {
+		h.applyBucket(name, key, action{a: _del})
+	}
+
+	return
+}
+
+// applyBucket will fulfill an action against the in-memory storage of a bucket
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) applyBucket(name, k string, v action) {
+	s := h.b[name]
+	switch v.a {
+	case _put:
+		if s == nil {
+			// Bucket does not exist, create it
+			s = make(storage)
+			h.b[name] = s
 		}
 
-		err = h.tf.WriteLine(ll.Bytes())
+		// Put by key
+		h.st.putValue(s[k], v.b)
+		s[k] = v.b
 
-	ITEREND:
-		bp.Put(ll)
-		ll = nil
+	case _del:
+		// Delete by key
+		h.st.putValue(s[k], nil)
+		delete(s, k)
 
-		if err != nil {
-			return
+		if len(s) == 0 {
+			// Bucket is empty, remove it
+			delete(h.b, name)
 		}
 	}
+}
 
-	// Add our current hash to the end
-	if err = h.newHashLine(h.tf, hash); err != nil {
-		return
+// dropBucket will remove a bucket and all of it's contents from the in-memory storage
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) dropBucket(name string) {
+	for _, v := range h.b[name] {
+		h.st.putValue(v, nil)
 	}
 
-	if err = h.tf.Close(); err != nil {
-		return
-	}
+	delete(h.b, name)
+}
+
+// apply will fulfill an action against the in-memory storage
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) apply(k string, v action) {
+	switch v.a {
+	case _put:
+		// Put by key
+		h.st.putValue(h.s[k], v.b)
+		h.s[k] = v.b
+
+		for _, idx := range h.idx {
+			// Update index terms for key
+			idx.put(k, v.b)
+		}
+
+		if v.e > 0 {
+			// Set expiry by key
+			h.e[k] = v.e
+		} else {
+			// Put without an expiry, ensure any previous expiry is removed
+			delete(h.e, k)
+		}
+
+	case _del:
+		// Delete by key
+		h.st.putValue(h.s[k], nil)
+		delete(h.s, k)
+		delete(h.e, k)
+
+		for _, idx := range h.idx {
+			// Remove key from index
+			idx.del(k)
+		}
+	}
+}
+
+// applyLease will set the leased upper bound for a sequence from an encoded lease body
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) applyLease(name string, b []byte) (err error) {
+	var n int64
+	if n, err = DecodeInt64(b); err != nil {
+		return
+	}
+
+	h.seqs[name] = uint64(n)
+	return
+}
+
+// lease will persist a new leased upper bound for a sequence
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) lease(name string, upper uint64) (err error) {
+	if h.opts.InMemory {
+		// We have no log to persist our lease to
+		goto END
+	}
+
+	if err = h.rollback(); err != nil {
+		return
+	}
+
+	if err = h.writeLogLine(h.writeLine, name, action{a: _lease, b: EncodeInt64(int64(upper))}); err != nil {
+		return
+	}
+
+	if err = h.flush(); err != nil {
+		return
+	}
+
+	// Our lease is streamed to followers as it is written
+	h.wake()
+
+END:
+	h.seqs[name] = upper
+	return
+}
+
+// isExpired will return whether or not the provided key has expired as of the provided time (in unix nanoseconds)
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) isExpired(k string, now int64) bool {
+	e, ok := h.e[k]
+	return ok && e <= now
+}
+
+// expired will return a delete action for every key which has expired as of the provided time (in unix nanoseconds)
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) expired(now int64) (a map[string]action) {
+	for k, e := range h.e {
+		if e > now {
+			continue
+		}
+
+		if a == nil {
+			a = make(map[string]action)
+		}
+
+		a[k] = action{a: _del}
+	}
+
+	return
+}
+
+// reap will delete expired keys on the provided interval until the reaper stop channel is closed
+func (h *Hippy) reap(interval time.Duration) {
+	tkr := time.NewTicker(interval)
+	defer tkr.Stop()
+
+	for {
+		select {
+		case <-tkr.C:
+		case <-h.rs:
+			return
+		}
+
+		h.mux.Lock()
+		if !h.closed {
+			if a := h.expired(time.Now().UnixNano()); a != nil {
+				// Persist delete actions for expired keys, any errors will be retried on the next tick
+				if err := h.write(a, nil); err != nil {
+					h.log.Warn("unable to delete expired keys", "keys", len(a), "err", err)
+				}
+			}
+		}
+		h.mux.Unlock()
+	}
+}
+
+// findHash will return the line index of the provided hash, the first hash is found when the provided hash is empty
+func (h *Hippy) findHash(tgt Backend, hash string) (pos int, err error) {
+	var (
+		li  int // Line index
+		key string
+	)
+
+	pos = -1
+	if rerr := tgt.ReadFrom(0, func(b *bytes.Buffer) (ok bool) {
+		if bb := b.Bytes(); len(bb) == 0 {
+			return
+		} else if bb[0] == _hash {
+			if key, _, err = h.parseLogLine(b); err != nil {
+				ok = true
+				return
+			}
+
+			if key == hash || len(hash) == 0 {
+				pos = li
+				ok = true
+			}
+		}
+
+		li++
+		return
+	}); err == nil {
+		err = rerr
+	}
+
+	if err == nil && pos == -1 {
+		err = ErrHashNotFound
+	}
+	return
+}
+
+func (h *Hippy) getLastHash(tgt Backend) (pos int, hash string, err error) {
+	var li int // Line index
+	pos = -1
+	if rerr := tgt.ReadFrom(0, func(b *bytes.Buffer) (ok bool) {
+		bb := b.Bytes()
+		if len(bb) > 0 && bb[0] == _hash {
+			pos = li
+			if hash, _, err = h.parseLogLine(b); err != nil {
+				ok = true
+				return
+			}
+		}
+
+		li++
+		return
+	}); err == nil {
+		err = rerr
+	}
+
+	if err == nil && pos == -1 {
+		err = ErrHashNotFound
+	}
+	return
+}
 
-	if err = h.f.Close(); err != nil {
+// getArchivePoint will return the line index of our log which follows the last archived hash
+func (h *Hippy) getArchivePoint() (line int, err error) {
+	var (
+		hash string
+		more bool // Lines remaining boolean
+	)
+
+	if _, hash, err = h.getLastHash(h.af); err != nil && err != ErrHashNotFound {
+		return
+	}
+
+	if line, err = h.findHash(h.f, hash); err != nil {
 		return
 	}
 
-	if err = os.Rename(h.tf.Location(), h.f.Location()); err != nil {
+	line++
+	if err = h.f.ReadFrom(line, func(*bytes.Buffer) bool {
+		more = true
+		return true
+	}); err != nil {
 		return
 	}
 
-	if err = h.f.Open(); err != nil {
+	if !more {
+		err = ErrNoChanges
+	}
+
+	return
+}
+
+// snapshot will pass the log lines of a compacted copy of the database to the provided func. The lines are terminated by a
+// checkpoint of our current log sequence number
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) snapshot(fn func([]byte) error) (err error) {
+	now := time.Now().UnixNano()
+	// Write data contents
+	for k, v := range h.s {
+		if h.isExpired(k, now) {
+			// Expired keys are not carried over
+			continue
+		}
+
+		if err = h.writeLogLine(fn, k, action{a: _put, b: v, e: h.e[k]}); err != nil {
+			return
+		}
+	}
+
+	// Write bucket contents
+	for name, s := range h.b {
+		for k, v := range s {
+			if err = h.writeLogLine(fn, name, newBucketAction(k, action{a: _put, b: v})); err != nil {
+				return
+			}
+		}
+	}
+
+	// Write sequence leases
+	for name, upper := range h.seqs {
+		if err = h.writeLogLine(fn, name, action{a: _lease, b: EncodeInt64(int64(upper))}); err != nil {
+			return
+		}
+	}
+
+	// Mark the end of our compacted data with our current log sequence number
+	return h.writeLogLine(fn, "", action{a: _checkpoint, b: EncodeInt64(int64(h.seq))})
+}
+
+// repairArchive will discard any lines following the last complete hash of our archive. They are the partial copy of an
+// archive which was interrupted by a crash, a torn line would otherwise be joined by the next line we archive
+func (h *Hippy) repairArchive() (err error) {
+	var (
+		li  int // Line index
+		end int // Line index following our last complete hash
+	)
+
+	h.mux.Lock()
+	if h.ro {
+		goto END
+	}
+
+	if err = h.af.ReadFrom(0, func(b *bytes.Buffer) (ok bool) {
+		li++
+		if bb := b.Bytes(); len(bb) == 0 || bb[0] != _hash {
+			return
+		}
+
+		if _, _, perr := h.parseLogLine(b); perr == nil {
+			end = li
+		}
+
 		return
+	}); err != nil || end == li {
+		goto END
 	}
 
-	err = h.f.SeekToEnd()
+	h.log.Warn("archive ends with a partial copy", "line", end, "lines", li-end)
+	err = h.af.Truncate(end)
+
+END:
+	h.mux.Unlock()
+	return
+}
+
+func (h *Hippy) archive() (err error) {
+	var (
+		line, n int
+		al      int // Number of lines archived
+	)
+
+	start := time.Now()
+	defer func() {
+		h.maintained(Trace{Op: TraceArchive, Lines: al, Err: err}, start)
+	}()
+
+	if err = h.rollback(); err != nil {
+		return
+	}
+
+	if line, err = h.getArchivePoint(); err != nil {
+		return
+	}
+
+	if n, err = countLines(h.af); err != nil {
+		return
+	}
+
+	if err = h.newHashLine(h.writeLine, ""); err != nil {
+		return
+	}
+
+	if err = h.flush(); err != nil {
+		return
+	}
+
+	// Append every line following our last archived hash, up to and including our new hash
+	if rerr := h.f.ReadFrom(line, func(b *bytes.Buffer) bool {
+		if err = h.af.Append(b.Bytes()); err != nil {
+			return true
+		}
+
+		al++
+		return false
+	}); err == nil {
+		err = rerr
+	}
+
+	if err == nil {
+		err = h.af.Flush()
+	}
+
+	if err != nil {
+		// Remove our partial copy so that it is not completed by a later flush, our log remains intact
+		if terr := h.af.Truncate(n); terr != nil {
+			h.log.Error("unable to remove partial archive", "line", n, "err", terr)
+		}
+	}
+
+	return
+}
+
+func (h *Hippy) compact() (err error) {
+	var (
+		hash string
+		n    int   // Number of lines written
+		size int64 // Number of bytes written
+	)
+
+	start := time.Now()
+	defer func() {
+		h.maintained(Trace{Op: TraceCompact, Keys: h.keyCount(), Lines: n, Err: err}, start)
+	}()
+
+	if _, hash, err = h.getLastHash(h.f); err != nil {
+		return
+	}
+
+	// Line indexes held by readers between lock acquisitions are stale once we begin replacing our log
+	h.gen++
+	if err = h.f.Replace(func(write func([]byte) error) (err error) {
+		count := func(line []byte) (err error) {
+			if err = write(line); err == nil {
+				n++
+				size += int64(len(line) + 1)
+			}
+
+			return
+		}
+
+		// Write our data contents
+		if err = h.snapshot(count); err != nil {
+			return
+		}
+
+		// Add our current hash to the end
+		return h.newHashLine(count, hash)
+	}); err != nil {
+		return
+	}
+
+	// Our log has been replaced in full, any unflushed lines were discarded
+	h.end = n
+	h.pending = 0
+	h.dirty = false
+	h.st.records = 0
+	h.st.bytesWritten += size
+	return
+}
+
+// keyCount will return the number of root and bucket keys
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) keyCount() (n int) {
+	n = len(h.s)
+	for _, b := range h.b {
+		n += len(b)
+	}
+
+	return
+}
+
+// lineCounter is implemented by backends which are able to count their lines without reading them
+type lineCounter interface {
+	lineCount() (int, error)
+}
+
+// countLines will return the number of lines within a backend
+func countLines(tgt Backend) (n int, err error) {
+	if lc, ok := tgt.(lineCounter); ok {
+		return lc.lineCount()
+	}
+
+	err = tgt.ReadFrom(0, func(*bytes.Buffer) bool {
+		n++
+		return false
+	})
+
 	return
 }
 
@@ -527,6 +1272,7 @@ func (h *Hippy) newReadTx() *ReadTx {
 func (h *Hippy) newWriteTx() *WriteTx {
 	return &WriteTx{
 		a: make(map[string]action),
+		b: make(bucketChanges),
 	}
 }
 
@@ -535,6 +1281,7 @@ func (h *Hippy) newReadWriteTx() *ReadWriteTx {
 	return &ReadWriteTx{
 		h: h,
 		a: make(map[string]action),
+		b: make(bucketChanges),
 	}
 }
 
@@ -567,6 +1314,7 @@ func (h *Hippy) putWriteTx(tx *WriteTx) {
 		delete(tx.a, k)
 	}
 
+	tx.b.reset()
 	h.wtxp.Put(tx)
 }
 
@@ -576,15 +1324,32 @@ func (h *Hippy) putReadWriteTx(tx *ReadWriteTx) {
 		delete(tx.a, k)
 	}
 
+	tx.b.reset()
 	h.rwtxp.Put(tx)
 }
 
 // Read will return a read-only transaction
 func (h *Hippy) Read(fn func(*ReadTx) error) (err error) {
+	return h.ReadCtx(context.Background(), fn)
+}
+
+// ReadCtx will return a read-only transaction, ctx.Err() is returned if the context is done before the lock is acquired
+func (h *Hippy) ReadCtx(ctx context.Context, fn func(*ReadTx) error) (err error) {
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	start := time.Now()
+	if err = h.rlockCtx(ctx); err != nil {
+		return
+	}
+
+	h.begin(start, false)
+
 	// Get a read transaction from the pool
 	tx := h.getReadTx()
 
-	h.mux.RLock()
 	if h.closed {
 		err = ErrIsClosed
 	} else {
@@ -599,19 +1364,48 @@ func (h *Hippy) Read(fn func(*ReadTx) error) (err error) {
 
 // ReadWrite returns a read/write transaction
 func (h *Hippy) ReadWrite(fn func(*ReadWriteTx) error) (err error) {
+	return h.ReadWriteCtx(context.Background(), fn)
+}
+
+// ReadWriteCtx returns a read/write transaction, ctx.Err() is returned if the context is done before the lock is acquired.
+// If the context is done before the transaction is written, the transaction is aborted
+func (h *Hippy) ReadWriteCtx(ctx context.Context, fn func(*ReadWriteTx) error) (err error) {
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	start := time.Now()
+	if err = h.lockCtx(ctx); err != nil {
+		return
+	}
+
+	h.begin(start, true)
+
 	// Get a read/write transaction from the pool
 	tx := h.getReadWriteTx()
 
-	h.mux.Lock()
 	if h.closed {
 		err = ErrIsClosed
 		goto END
 	}
 
-	if err = fn(tx); err == nil {
-		err = h.write(tx.a)
+	if h.ro {
+		err = ErrReadOnly
+		goto END
+	}
+
+	if err = fn(tx); err != nil {
+		goto END
+	}
+
+	if err = ctx.Err(); err != nil {
+		// Context is done, abort prior to writing
+		goto END
 	}
 
+	err = h.write(tx.a, tx.b)
+
 END:
 	h.mux.Unlock()
 	// Return read/write transaction to the pool
@@ -621,19 +1415,48 @@ END:
 
 // Write returns a write-only transaction
 func (h *Hippy) Write(fn func(*WriteTx) error) (err error) {
+	return h.WriteCtx(context.Background(), fn)
+}
+
+// WriteCtx returns a write-only transaction, ctx.Err() is returned if the context is done before the lock is acquired.
+// If the context is done before the transaction is written, the transaction is aborted
+func (h *Hippy) WriteCtx(ctx context.Context, fn func(*WriteTx) error) (err error) {
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	start := time.Now()
+	if err = h.lockCtx(ctx); err != nil {
+		return
+	}
+
+	h.begin(start, true)
+
 	// Get a write transaction from the pool
 	tx := h.getWriteTx()
 
-	h.mux.Lock()
 	if h.closed {
 		err = ErrIsClosed
 		goto END
 	}
 
-	if err = fn(tx); err == nil {
-		err = h.write(tx.a)
+	if h.ro {
+		err = ErrReadOnly
+		goto END
+	}
+
+	if err = fn(tx); err != nil {
+		goto END
 	}
 
+	if err = ctx.Err(); err != nil {
+		// Context is done, abort prior to writing
+		goto END
+	}
+
+	err = h.write(tx.a, tx.b)
+
 END:
 	h.mux.Unlock()
 	// Return write transaction to the pool
@@ -641,20 +1464,230 @@ END:
 	return
 }
 
+// lockCtx will acquire our write lock, ctx.Err() is returned if the context is done before the lock is acquired
+func (h *Hippy) lockCtx(ctx context.Context) error {
+	return acquireCtx(ctx, h.mux.Lock, h.mux.TryLock)
+}
+
+// rlockCtx will acquire our read lock, ctx.Err() is returned if the context is done before the lock is acquired
+func (h *Hippy) rlockCtx(ctx context.Context) error {
+	return acquireCtx(ctx, h.mux.RLock, h.mux.TryRLock)
+}
+
+// acquireCtx will acquire a lock, ctx.Err() is returned if the context is done before the lock is acquired.
+// A contended lock is retried with backoff rather than queued for, so that a caller whose context is done holds no place
+// in the lock's queue and leaves nothing behind
+func acquireCtx(ctx context.Context, lock func(), tryLock func() bool) (err error) {
+	if ctx.Done() == nil {
+		// Context can never be done, block until we have the lock
+		lock()
+		return
+	}
+
+	var t *time.Timer
+	backoff := minLockBackoff
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		if tryLock() {
+			return
+		}
+
+		if t == nil {
+			t = time.NewTimer(backoff)
+			defer t.Stop()
+		} else {
+			t.Reset(backoff)
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if backoff *= 2; backoff > maxLockBackoff {
+			backoff = maxLockBackoff
+		}
+	}
+}
+
+// CompareAndSwap will run a single-key read/write transaction which puts the new value only if the current value is equal to old
+func (h *Hippy) CompareAndSwap(k string, old, new []byte) (swapped bool, err error) {
+	err = h.ReadWrite(func(tx *ReadWriteTx) (err error) {
+		swapped, err = tx.CompareAndSwap(k, old, new)
+		return
+	})
+
+	return
+}
+
+// PutIfAbsent will run a single-key read/write transaction which puts the value only if the key does not exist
+func (h *Hippy) PutIfAbsent(k string, v []byte) (put bool, err error) {
+	err = h.ReadWrite(func(tx *ReadWriteTx) (err error) {
+		put, err = tx.PutIfAbsent(k, v)
+		return
+	})
+
+	return
+}
+
+// DelIfEqual will run a single-key read/write transaction which deletes the key only if the current value is equal to the provided value
+func (h *Hippy) DelIfEqual(k string, v []byte) (deleted bool, err error) {
+	err = h.ReadWrite(func(tx *ReadWriteTx) (err error) {
+		deleted, err = tx.DelIfEqual(k, v)
+		return
+	})
+
+	return
+}
+
+// Watch will return a channel which receives an event for every committed change to a root key with the provided prefix,
+// bucket keys are watched with WatchBucket. The channel is buffered, Opts.WatchPolicy determines what occurs when a consumer
+// falls behind. Cancel will close the channel
+func (h *Hippy) Watch(prefix string) (ch <-chan Event, cancel func()) {
+	return h.watch("", prefix)
+}
+
+// WatchBucket will return a channel which receives an event for every committed change to a key with the provided prefix
+// within the provided bucket. Dropping the bucket sends a single EventDropBucket, regardless of prefix, rather than an event
+// for each of it's keys. See Watch
+func (h *Hippy) WatchBucket(bucket, prefix string) (ch <-chan Event, cancel func()) {
+	return h.watch(bucket, prefix)
+}
+
+// watch will return a channel which receives the committed changes to a bucket (or the root keyspace) matching the provided prefix
+func (h *Hippy) watch(bucket, prefix string) (ch <-chan Event, cancel func()) {
+	w := h.w.add(bucket, prefix)
+	ch = w.ch
+	cancel = func() { h.w.remove(w) }
+	return
+}
+
+// Sequence will return a sequence generator for the provided name
+func (h *Hippy) Sequence(name string) (s *Sequence, err error) {
+	if len(name) > MaxKeyLen {
+		err = ErrInvalidKey
+		return
+	}
+
+	lease := h.opts.SequenceLease
+	if lease == 0 {
+		lease = defaultSequenceLease
+	}
+
+	s = &Sequence{
+		h:     h,
+		name:  name,
+		lease: lease,
+	}
+
+	return
+}
+
+// Archive will append all log entries since the last archive to the archive, ErrNoChanges is returned when there is
+// nothing to archive
+func (h *Hippy) Archive() (err error) {
+	return h.maintain(h.archive)
+}
+
+// Compact will replace the log with a snapshot of the current contents
+// Note: History which has not been archived is discarded, see Archive
+func (h *Hippy) Compact() (err error) {
+	return h.maintain(h.compact)
+}
+
+// maintain will run a maintenance function while holding the write lock
+func (h *Hippy) maintain(fn func() error) (err error) {
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	h.mux.Lock()
+	switch {
+	case h.closed:
+		err = ErrIsClosed
+	case h.opts.InMemory:
+		err = ErrInMemory
+	case h.ro:
+		err = ErrReadOnly
+	default:
+		err = fn()
+	}
+	h.mux.Unlock()
+	return
+}
+
 // Close will close Hippy
+// Note: Close will wait for all in-flight transactions to complete, see Shutdown
 func (h *Hippy) Close() (err error) {
+	return h.Shutdown(context.Background())
+}
+
+// Shutdown will gracefully close Hippy. New transactions are immediately rejected with ErrIsClosed, in-flight transactions
+// (including those waiting on a lock) are allowed to complete, and then the database is archived, compacted, and closed.
+// If the context is done before in-flight transactions complete, ctx.Err() is returned and the database remains open, but
+// continues to reject new transactions. All other failures are aggregated as an ErrorList
+func (h *Hippy) Shutdown(ctx context.Context) (err error) {
+	var errs ErrorList
+	// Reject any new transactions
+	atomic.StoreInt32(&h.closing, 1)
+
+	// Wait for in-flight transactions to exit
+	if err = acquireCtx(ctx, h.gate.Lock, h.gate.TryLock); err != nil {
+		return
+	}
+
 	h.mux.Lock()
 	if h.closed {
-		err = ErrIsClosed
-		goto END
+		h.mux.Unlock()
+		h.gate.Unlock()
+		return ErrIsClosed
 	}
+
 	h.closed = true
 
+	if h.rs != nil {
+		// Stop the expiry reaper
+		close(h.rs)
+	}
+
+	// Close all watcher channels
+	h.w.closeAll()
+	// Wake anyone waiting on our next commit
+	close(h.cc)
+
+	if !h.opts.InMemory {
+		if !h.opts.ReadOnly {
+			errs.Push(h.archiveAndCompact())
+		}
+
+		errs.Push(h.f.Close())
+		errs.Push(h.af.Close())
+	}
+
+	if h.lk != nil {
+		// Release our inter-process lock
+		errs.Push(h.lk.release())
+		h.lk = nil
+	}
+
+	h.mux.Unlock()
+	h.gate.Unlock()
+	return errs.Err()
+}
+
+// archiveAndCompact will archive and compact the database, as configured by our options
+// Note: Compaction does not occur when archiving fails, as un-archived history would be lost
+func (h *Hippy) archiveAndCompact() (err error) {
 	if h.opts.ArchiveOnClose {
 		if err = h.archive(); err == ErrNoChanges {
 			err = nil
 		} else if err != nil {
-			goto END
+			return
 		}
 	}
 
@@ -662,7 +1695,20 @@ func (h *Hippy) Close() (err error) {
 		err = h.compact()
 	}
 
-END:
-	h.mux.Unlock()
 	return
 }
+
+// enter will enter a transaction, ErrIsClosed is returned if the database is shutting down
+func (h *Hippy) enter() error {
+	if atomic.LoadInt32(&h.closing) == 1 {
+		return ErrIsClosed
+	}
+
+	h.gate.RLock()
+	return nil
+}
+
+// exit will exit a transaction
+func (h *Hippy) exit() {
+	h.gate.RUnlock()
+}
@@ -1,14 +1,19 @@
 package hippy
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
-	//"time"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/itsmontoya/middleware"
@@ -136,59 +141,1897 @@ func TestMWBasic(t *testing.T) {
 }
 
 func TestMedium(t *testing.T) {
+	var (
+		ok  bool
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "medium_test", opts); err != nil {
+		fmt.Println("Error opening:", err)
+		return
+	}
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		_, ok = txn.Get("greeting")
+		//	fmt.Println(string(b), ok)
+
+		txn.Put("greeting", []byte(`Hello!`))
+		_, ok = txn.Get("greeting")
+		return
+	})
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		txn.Put("greeting", []byte("NO!!"))
+		_, ok = txn.Get("greeting")
+		return errors.New("Merp")
+	})
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		if _, ok = txn.Get("greeting"); !ok {
+			t.Error("key isn't found")
+		}
+		return
+	})
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		txn.Del("greeting")
+		return
+	})
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		if _, ok = txn.Get("greeting"); ok {
+			t.Error("key was found")
+		}
+		return
+	})
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		txn.Put("greeting", []byte("Hello!"))
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "medium_test.hdb"))
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	var (
+		ok  bool
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "cas_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if ok, err = db.PutIfAbsent("lease", []byte("a")); err != nil || !ok {
+		t.Fatal("expected put on absent key", ok, err)
+	}
+
+	if ok, err = db.PutIfAbsent("lease", []byte("b")); err != nil || ok {
+		t.Fatal("expected no put on existing key", ok, err)
+	}
+
+	if ok, err = db.CompareAndSwap("lease", []byte("b"), []byte("c")); err != nil || ok {
+		t.Fatal("expected no swap on mismatched value", ok, err)
+	}
+
+	if ok, err = db.CompareAndSwap("lease", []byte("a"), []byte("c")); err != nil || !ok {
+		t.Fatal("expected swap on matching value", ok, err)
+	}
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		txn.Del("lease")
+		if ok, _ = txn.CompareAndSwap("lease", []byte("c"), []byte("d")); ok {
+			t.Error("swapped a key deleted within the transaction")
+		}
+
+		if ok, _ = txn.PutIfAbsent("lease", []byte("d")); !ok {
+			t.Error("expected put on key deleted within the transaction")
+		}
+		return
+	})
+
+	if _, err = db.DelIfEqual(strings.Repeat("k", MaxKeyLen+1), []byte("d")); err != ErrInvalidKey {
+		t.Fatalf("expected %v and received %v", ErrInvalidKey, err)
+	}
+
+	if ok, err = db.DelIfEqual("lease", []byte("c")); err != nil || ok {
+		t.Fatal("expected no delete on mismatched value", ok, err)
+	}
+
+	if ok, err = db.DelIfEqual("lease", []byte("d")); err != nil || !ok {
+		t.Fatal("expected delete on matching value", ok, err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Get("lease"); ok {
+			t.Error("key was found")
+		}
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "cas_test.hdb"))
+}
+
+func TestTTL(t *testing.T) {
+	var (
+		ok  bool
+		db  *Hippy
+		err error
+	)
+
+	ttlOpts := opts
+	ttlOpts.ReapInterval = time.Millisecond * 10
+
+	if db, err = New(tmpPath, "ttl_test", ttlOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		if err = txn.PutWithTTL("session", testVal, time.Millisecond*50); err != nil {
+			return
+		}
+
+		return txn.PutWithTTL("bucket", testVal, time.Hour)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Get("session"); !ok {
+			t.Error("key isn't found")
+		}
+		return
+	})
+
+	time.Sleep(time.Millisecond * 60)
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Get("session"); ok {
+			t.Error("expired key was found")
+		}
+
+		if len(txn.Keys()) != 1 {
+			t.Error("expected expired key to be excluded from keys")
+		}
+		return
+	})
+
+	time.Sleep(time.Millisecond * 30)
+
+	db.mux.RLock()
+	if _, ok = db.s["session"]; ok {
+		t.Error("expired key was not reaped")
+	}
+	db.mux.RUnlock()
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "ttl_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if exp := db.e["bucket"]; exp <= time.Now().UnixNano() {
+		t.Error("expiry was not persisted", exp)
+	}
+
+	// Conditional writes and counters retain the expiry of the key they overwrite
+	exp := db.e["bucket"]
+	if err = db.Write(func(txn *WriteTx) error {
+		return txn.PutWithTTL("counter", EncodeInt64(1), time.Hour)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cexp := db.e["counter"]
+	if ok, err = db.CompareAndSwap("bucket", testVal, []byte("swapped")); err != nil || !ok {
+		t.Fatal("expected swap on matching value", ok, err)
+	}
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		_, err = txn.Incr("counter", 1)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.e["bucket"] != exp || db.e["counter"] != cexp {
+		t.Errorf("expiries were not retained: %d and %d, expected %d and %d", db.e["bucket"], db.e["counter"], exp, cexp)
+	}
+
+	db.Close()
+
+	// Keys which have expired but have not been reaped have no expiry, as they do not exist
+	noReapOpts := opts
+	noReapOpts.ReapInterval = 0
+	if db, err = New(tmpPath, "ttl_test", noReapOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) error {
+		return txn.PutWithTTL("short", EncodeInt64(1), time.Millisecond*20)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 30)
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Expiry("short"); ok {
+			t.Error("expected no expiry for an expired key")
+		}
+		return
+	})
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		if _, ok = txn.Expiry("short"); ok {
+			t.Error("expected no expiry for an expired key")
+		}
+
+		// Our counter starts over, without the expiry of the key it replaces
+		_, err = txn.Incr("short", 1)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Get("short"); !ok {
+			t.Error("key isn't found")
+		}
+
+		if _, ok = txn.Expiry("short"); ok {
+			t.Error("expected no expiry for a replaced key")
+		}
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "ttl_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "ttl_test.archive.hdb"))
+}
+
+func TestIncr(t *testing.T) {
+	var (
+		n   int64
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "incr_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		if n, err = txn.Incr("counter", 5); err != nil {
+			return
+		}
+
+		n, err = txn.Incr("counter", -2)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Fatalf("invalid counter value, expected 3 and received %d", n)
+	}
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		txn.Put("greeting", []byte("Hello!"))
+		_, err = txn.Incr("greeting", 1)
+		return
+	}); err != ErrInvalidInt {
+		t.Fatalf("expected %v and received %v", ErrInvalidInt, err)
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "incr_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "incr_test.archive.hdb"))
+}
+
+func TestKeysAfter(t *testing.T) {
+	var (
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "keys_after_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Write(func(txn *WriteTx) (err error) {
+		for _, k := range []string{"user:3", "user:1", "team:1", "user:4", "user:2"} {
+			txn.Put(k, testVal)
+		}
+
+		return txn.PutWithTTL("user:0", testVal, time.Nanosecond)
+	})
+
+	var pages [][]string
+	after := ""
+	for more := true; more; {
+		var keys []string
+		db.Read(func(txn *ReadTx) (err error) {
+			keys, more = txn.KeysAfter("user:", after, 2)
+			return
+		})
+
+		pages = append(pages, keys)
+		after = keys[len(keys)-1]
+	}
+
+	if fmt.Sprint(pages) != "[[user:1 user:2] [user:3 user:4]]" {
+		t.Fatalf("invalid pages: %v", pages)
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "keys_after_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "keys_after_test.archive.hdb"))
+}
+
+func TestSequence(t *testing.T) {
+	var (
+		id   uint64
+		last uint64
+		seq  *Sequence
+		db   *Hippy
+		err  error
+	)
+
+	seqOpts := opts
+	seqOpts.SequenceLease = 10
+
+	if db, err = New(tmpPath, "seq_test", seqOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if seq, err = db.Sequence("ids"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 25; i++ {
+		if id, err = seq.Next(); err != nil {
+			t.Fatal(err)
+		}
+
+		if id <= last {
+			t.Fatalf("non-increasing id, %d after %d", id, last)
+		}
+
+		last = id
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "seq_test", seqOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if seq, err = db.Sequence("ids"); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err = seq.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id <= last {
+		t.Fatalf("id was re-issued after re-open, %d after %d", id, last)
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "seq_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "seq_test.archive.hdb"))
+}
+
+func TestBuckets(t *testing.T) {
+	var (
+		b   []byte
+		ok  bool
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "bucket_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("name", []byte("root"))
+		txn.Bucket("users").Put("name", []byte("users"))
+		txn.Bucket("users").Put("email", []byte("users@example.com"))
+		return txn.Bucket("teams").Put("name", []byte("teams"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		if b, ok = txn.Bucket("users").Get("name"); !ok || string(b) != "users" {
+			t.Errorf("invalid bucket value: %s", b)
+		}
+
+		if err = txn.DeleteBucket("teams"); err != nil {
+			return
+		}
+
+		if _, ok = txn.Bucket("teams").Get("name"); ok {
+			t.Error("key was found in dropped bucket")
+		}
+
+		return txn.Bucket("teams").Put("id", []byte("1"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) error {
+		return txn.Bucket("users").Del(strings.Repeat("k", MaxKeyLen+1))
+	}); err != ErrInvalidKey {
+		t.Fatalf("expected %v and received %v", ErrInvalidKey, err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) error {
+		return txn.Bucket("").Del("name")
+	}); err != ErrInvalidBucket {
+		t.Fatalf("expected %v and received %v", ErrInvalidBucket, err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "bucket_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("name"); !ok || string(b) != "root" {
+			t.Errorf("invalid root value: %s", b)
+		}
+
+		if keys := txn.Bucket("teams").Keys(); len(keys) != 1 || keys[0] != "id" {
+			t.Errorf("invalid bucket keys: %v", keys)
+		}
+
+		var keys []string
+		txn.Bucket("users").ForEach(func(k string, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+
+		if len(keys) != 2 || keys[0] != "email" || keys[1] != "name" {
+			t.Errorf("invalid bucket iteration: %v", keys)
+		}
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "bucket_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "bucket_test.archive.hdb"))
+}
+
+func TestIndex(t *testing.T) {
+	var (
+		keys []string
+		db   *Hippy
+		err  error
+	)
+
+	idxOpts := opts
+	idxOpts.Indexes = map[string]IndexFunc{
+		"byStatus": func(key string, val []byte) []string {
+			return []string{string(val)}
+		},
+	}
+
+	if db, err = New(tmpPath, "index_test", idxOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("1", []byte("active"))
+		txn.Put("2", []byte("banned"))
+		txn.Put("3", []byte("active"))
+		return
+	})
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("1", []byte("inactive"))
+		txn.Del("3")
+		return
+	})
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "index_test", idxOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if keys = txn.Index("byStatus").Get("active"); len(keys) != 0 {
+			t.Errorf("invalid index keys: %v", keys)
+		}
+
+		if keys = txn.Index("byStatus").Get("inactive"); len(keys) != 1 || keys[0] != "1" {
+			t.Errorf("invalid index keys: %v", keys)
+		}
+
+		keys = keys[:0]
+		txn.Index("byStatus").Range("b", "j", func(term, key string) error {
+			keys = append(keys, key)
+			return nil
+		})
+
+		if len(keys) != 2 || keys[0] != "2" || keys[1] != "1" {
+			t.Errorf("invalid index range keys: %v", keys)
+		}
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "index_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "index_test.archive.hdb"))
+}
+
+func TestWatch(t *testing.T) {
+	var (
+		db  *Hippy
+		err error
+	)
+
+	watchOpts := opts
+	watchOpts.WatchBuffer = 2
+
+	if db, err = New(tmpPath, "watch_test", watchOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	users, cancel := db.Watch("user:")
+	defer cancel()
+
+	slow, _ := db.Watch("")
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("user:1", []byte("John Doe"))
+		txn.Put("team:1", []byte("Hippies"))
+		return
+	})
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Del("user:1")
+		return
+	})
+
+	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		txn.Put("user:2", []byte("Jane Doe"))
+		return errors.New("rollback")
+	})
+
+	if e := <-users; e.Type != EventPut || e.Key != "user:1" || string(e.Value) != "John Doe" {
+		t.Errorf("invalid event: %+v", e)
+	}
+
+	if e := <-users; e.Type != EventDel || e.Key != "user:1" || e.Seq != 2 {
+		t.Errorf("invalid event: %+v", e)
+	}
+
+	select {
+	case e := <-users:
+		t.Errorf("received event for rolled back transaction: %+v", e)
+	default:
+	}
+
+	// Our slow watcher received three events with a buffer of two, it's channel should be closed
+	<-slow
+	<-slow
+	if _, ok := <-slow; ok {
+		t.Error("slow watcher was not closed")
+	}
+
+	// Bucket keys are only received by watchers of their bucket, and a dropped bucket reaches every prefix
+	members, mcancel := db.WatchBucket("members", "user:")
+	defer mcancel()
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Bucket("members").Put("user:4", []byte("Jim Doe"))
+		txn.Bucket("members").Put("team:1", []byte("Hippies"))
+		txn.Put("user:5", []byte("Jill Doe"))
+		return txn.Put("user:3", []byte("Jack Doe"))
+	})
+
+	db.Write(func(txn *WriteTx) (err error) {
+		return txn.DeleteBucket("members")
+	})
+
+	// Events within a commit are ordered by key
+	if e := <-users; e.Key != "user:3" || e.Bucket != "" {
+		t.Errorf("invalid event: %+v", e)
+	}
+
+	if e := <-users; e.Key != "user:5" || e.Bucket != "" {
+		t.Errorf("invalid event: %+v", e)
+	}
+
+	if e := <-members; e.Type != EventPut || e.Bucket != "members" || e.Key != "user:4" {
+		t.Errorf("invalid event: %+v", e)
+	}
+
+	if e := <-members; e.Type != EventDropBucket || e.Bucket != "members" || e.Seq != 4 {
+		t.Errorf("invalid event: %+v", e)
+	}
+
+	select {
+	case e := <-users:
+		t.Errorf("received event outside of the root keyspace: %+v", e)
+	default:
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "watch_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "watch_test.archive.hdb"))
+}
+
+func TestChangesSince(t *testing.T) {
+	var (
+		cs  []Commit
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "changes_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	for _, k := range testKeys[:3] {
+		db.Write(func(txn *WriteTx) (err error) {
+			return txn.Put(k, testVal)
+		})
+	}
+
+	// Close will archive and compact our log
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "changes_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if lsn := db.LSN(); lsn != 3 {
+		t.Fatalf("invalid log sequence number, expected 3 and received %d", lsn)
+	}
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Del(testKeys[0])
+		return txn.Bucket("users").Put("1", testVal)
+	})
+
+	collect := func(c Commit) error {
+		cs = append(cs, c)
+		return nil
+	}
+
+	if err = db.ChangesSince(0, collect); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cs) != 4 {
+		t.Fatalf("invalid number of commits, expected 4 and received %d", len(cs))
+	}
+
+	for i, c := range cs {
+		if c.LSN != uint64(i+1) {
+			t.Errorf("invalid log sequence number, expected %d and received %d", i+1, c.LSN)
+		}
+	}
+
+	if es := cs[0].Events; len(es) != 1 || es[0].Key != testKeys[0] || es[0].Type != EventPut {
+		t.Errorf("invalid events: %+v", es)
+	}
+
+	if es := cs[3].Events; len(es) != 2 {
+		t.Errorf("invalid events: %+v", es)
+	}
+
+	cs = cs[:0]
+	if err = db.ChangesSince(3, collect); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cs) != 1 || cs[0].LSN != 4 {
+		t.Fatalf("invalid commits: %+v", cs)
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "changes_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "changes_test.archive.hdb"))
+
+	// Our log may be replaced between batches, iteration seeks to it's position within the archive
+	for _, archive := range []bool{true, false} {
+		if db, err = New(tmpPath, "changes_seek_test", opts); err != nil {
+			t.Fatal("Error opening:", err)
+		}
+
+		n := changesBatchSize*2 + 1
+		for i := 0; i < n; i++ {
+			db.Write(func(txn *WriteTx) (err error) {
+				return txn.Put(fmt.Sprint(i), testVal)
+			})
+		}
+
+		var lsn uint64
+		err = db.ChangesSince(0, func(c Commit) (err error) {
+			if c.LSN != lsn+1 {
+				t.Fatalf("invalid log sequence number, expected %d and received %d", lsn+1, c.LSN)
+			}
+
+			if lsn = c.LSN; lsn != 1 {
+				return
+			}
+
+			if archive {
+				if err = db.Archive(); err != nil {
+					return
+				}
+			}
+
+			return db.Compact()
+		})
+
+		switch {
+		case archive && (err != nil || lsn != uint64(n)):
+			t.Fatalf("expected to read through %d and read through %d: %v", n, lsn, err)
+		case !archive && err != ErrLSNUnavailable:
+			t.Fatalf("expected %v and received %v", ErrLSNUnavailable, err)
+		}
+
+		db.Close()
+		os.Remove(filepath.Join(tmpPath, "changes_seek_test.hdb"))
+		os.Remove(filepath.Join(tmpPath, "changes_seek_test.archive.hdb"))
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var (
+		cs  []Commit
+		db  *Hippy
+		err error
+
+		errInvalidKey = errors.New("keys must be prefixed with \"user:\"")
+	)
+
+	hookOpts := opts
+	hookOpts.PreCommit = []PreCommitFunc{
+		func(es []Event) error {
+			for _, e := range es {
+				if !strings.HasPrefix(e.Key, "user:") {
+					return errInvalidKey
+				}
+			}
+
+			return nil
+		},
+	}
+
+	hookOpts.PostCommit = []PostCommitFunc{
+		func(c Commit) {
+			cs = append(cs, c)
+		},
+	}
+
+	if db, err = New(tmpPath, "hooks_test", hookOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("user:1", testVal)
+		return txn.Put("team:1", testVal)
+	}); err != errInvalidKey {
+		t.Fatalf("expected %v and received %v", errInvalidKey, err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("user:1", testVal)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if keys := txn.Keys(); len(keys) != 1 {
+			t.Errorf("invalid keys: %v", keys)
+		}
+		return
+	})
+
+	if len(cs) != 1 || cs[0].LSN != 1 || cs[0].Events[0].Key != "user:1" {
+		t.Errorf("invalid post-commit changes: %+v", cs)
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "hooks_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "hooks_test.archive.hdb"))
+}
+
+func TestReplication(t *testing.T) {
+	var (
+		b        []byte
+		ok       bool
+		leader   *Hippy
+		follower *Hippy
+		err      error
+	)
+
+	if leader, err = New(tmpPath, "repl_leader", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	roOpts := opts
+	roOpts.ReadOnly = true
+
+	if follower, err = New(tmpPath, "repl_follower", roOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	waitForLSN := func(lsn uint64) {
+		for i := 0; i < 100 && follower.LSN() < lsn; i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		if follower.LSN() != lsn {
+			t.Fatalf("follower did not reach log sequence number %d", lsn)
+		}
+	}
+
+	leader.Write(func(txn *WriteTx) (err error) {
+		txn.Put("greeting", []byte("Hello!"))
+		return txn.Bucket("users").Put("1", []byte("John Doe"))
+	})
+
+	leader.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("name", []byte("Hippy"))
+	})
+
+	lc, fc := net.Pipe()
+	lerr := make(chan error, 1)
+	ferr := make(chan error, 1)
+	go func() { lerr <- leader.ServeFollower(lc) }()
+	go func() { ferr <- follower.Follow(fc) }()
+
+	waitForLSN(2)
+
+	leader.Write(func(txn *WriteTx) (err error) {
+		txn.Del("greeting")
+		return
+	})
+
+	waitForLSN(3)
+
+	// Replacing our log while a follower is caught up must not lose it's position
+	if err = leader.Archive(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = leader.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	leader.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("compacted", []byte("true"))
+	})
+
+	waitForLSN(4)
+
+	// Sequence leases are written outside of commits, they must reach our follower without one
+	var (
+		seq   *Sequence
+		upper uint64
+	)
+
+	if seq, err = leader.Sequence("ids"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = seq.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	leader.mux.RLock()
+	lease := leader.seqs["ids"]
+	leader.mux.RUnlock()
+
+	for i := 0; i < 100 && upper < lease; i++ {
+		time.Sleep(time.Millisecond * 10)
+		follower.mux.RLock()
+		upper = follower.seqs["ids"]
+		follower.mux.RUnlock()
+	}
+
+	if upper != lease {
+		t.Fatalf("follower did not receive lease, expected %d and received %d", lease, upper)
+	}
+
+	if err = follower.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("greeting", []byte("Hello!"))
+	}); err != ErrReadOnly {
+		t.Fatalf("expected %v and received %v", ErrReadOnly, err)
+	}
+
+	lc.Close()
+	if err = <-ferr; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-lerr; err != nil && err != io.ErrClosedPipe {
+		t.Fatal(err)
+	}
+
+	leader.Close()
+	follower.Close()
+
+	if follower, err = New(tmpPath, "repl_follower", roOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	follower.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Get("greeting"); ok {
+			t.Error("deleted key was found")
+		}
+
+		if b, ok = txn.Get("name"); !ok || string(b) != "Hippy" {
+			t.Errorf("invalid value: %s", b)
+		}
+
+		if b, ok = txn.Bucket("users").Get("1"); !ok || string(b) != "John Doe" {
+			t.Errorf("invalid bucket value: %s", b)
+		}
+
+		if b, ok = txn.Get("compacted"); !ok || string(b) != "true" {
+			t.Errorf("invalid value: %s", b)
+		}
+		return
+	})
+
+	if lsn := follower.LSN(); lsn != 4 {
+		t.Errorf("invalid log sequence number, expected 4 and received %d", lsn)
+	}
+
+	if upper = follower.seqs["ids"]; upper != lease {
+		t.Errorf("lease was not persisted, expected %d and received %d", lease, upper)
+	}
+
+	follower.Close()
+	for _, name := range []string{"repl_leader", "repl_follower"} {
+		os.Remove(filepath.Join(tmpPath, name+".hdb"))
+		os.Remove(filepath.Join(tmpPath, name+".archive.hdb"))
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	var (
+		b      []byte
+		ok     bool
+		before []byte
+		after  []byte
+		db     *Hippy
+		err    error
+	)
+
+	if db, err = New(tmpPath, "readonly_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("greeting", []byte("Hello!"))
+	})
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loc := filepath.Join(tmpPath, "readonly_test.hdb")
+	if before, err = ioutil.ReadFile(loc); err != nil {
+		t.Fatal(err)
+	}
+
+	roOpts := opts
+	roOpts.ReadOnly = true
+
+	if db, err = New(tmpPath, "readonly_test", roOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("greeting"); !ok || string(b) != "Hello!" {
+			t.Errorf("invalid value: %s", b)
+		}
+		return
+	})
+
+	if err = db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		return txn.Put("greeting", []byte("Goodbye!"))
+	}); err != ErrReadOnly {
+		t.Fatalf("expected %v and received %v", ErrReadOnly, err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if after, err = ioutil.ReadFile(loc); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(before, after) {
+		t.Error("read-only instance modified the log")
+	}
+
+	if db, err = New(tmpPath, "readonly_empty_test", roOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Close()
+
+	loc = filepath.Join(tmpPath, "readonly_empty_test.hdb")
+	if b, _ = ioutil.ReadFile(loc); len(b) != 0 {
+		t.Error("read-only instance wrote a hash line")
+	}
+
+	os.Remove(loc)
+	os.Remove(filepath.Join(tmpPath, "readonly_empty_test.archive.hdb"))
+	os.Remove(filepath.Join(tmpPath, "readonly_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "readonly_test.archive.hdb"))
+}
+
+func TestLocked(t *testing.T) {
+	var (
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "lock_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if _, err = New(tmpPath, "lock_test", opts); err != ErrLocked {
+		t.Fatalf("expected %v and received %v", ErrLocked, err)
+	}
+
+	// Read-only instances may be opened alongside a writer, but may not follow a leader as they would write to our log
+	roOpts := opts
+	roOpts.ReadOnly = true
+
+	var ro *Hippy
+	if ro, err = New(tmpPath, "lock_test", roOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	conn, _ := net.Pipe()
+	if err = ro.Follow(conn); err != ErrLocked {
+		t.Fatalf("expected %v and received %v", ErrLocked, err)
+	}
+
+	conn.Close()
+	ro.Close()
+
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		db.Close()
+	}()
+
+	waitOpts := opts
+	waitOpts.LockTimeout = time.Second
+
+	if db, err = New(tmpPath, "lock_test", waitOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "lock_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "lock_test.archive.hdb"))
+	os.Remove(filepath.Join(tmpPath, "lock_test.lock"))
+}
+
+func TestContext(t *testing.T) {
+	var (
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "context_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		close(locked)
+		<-release
+		return
+	})
+
+	<-locked
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	if err = db.ReadCtx(ctx, func(txn *ReadTx) (err error) {
+		t.Error("transaction ran without acquiring the lock")
+		return
+	}); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v and received %v", context.DeadlineExceeded, err)
+	}
+
+	cancel()
+	close(release)
+
+	// A writer which gives up must not remain queued for the lock, where it would block new readers
+	rlocked := make(chan struct{})
+	rrelease := make(chan struct{})
+	go db.Read(func(txn *ReadTx) (err error) {
+		close(rlocked)
+		<-rrelease
+		return
+	})
+
+	<-rlocked
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*10)
+	if err = db.WriteCtx(ctx, func(txn *WriteTx) (err error) {
+		t.Error("transaction ran without acquiring the lock")
+		return
+	}); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v and received %v", context.DeadlineExceeded, err)
+	}
+
+	cancel()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	if err = db.ReadCtx(ctx, func(txn *ReadTx) (err error) {
+		return
+	}); err != nil {
+		t.Fatalf("reader was blocked by an abandoned writer: %v", err)
+	}
+
+	cancel()
+	close(rrelease)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	if err = db.WriteCtx(ctx, func(txn *WriteTx) (err error) {
+		txn.Put("greeting", []byte("Hello!"))
+		cancel()
+		return
+	}); err != context.Canceled {
+		t.Fatalf("expected %v and received %v", context.Canceled, err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok := txn.Get("greeting"); ok {
+			t.Error("aborted transaction was committed")
+		}
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "context_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "context_test.archive.hdb"))
+}
+
+func TestShutdown(t *testing.T) {
+	var (
+		b   []byte
+		ok  bool
+		db  *Hippy
+		err error
+	)
+
+	if db, err = New(tmpPath, "shutdown_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go db.ReadWrite(func(txn *ReadWriteTx) (err error) {
+		close(locked)
+		<-release
+		return txn.Put("greeting", []byte("Hello!"))
+	})
+
+	<-locked
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	if err = db.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v and received %v", context.DeadlineExceeded, err)
+	}
+	cancel()
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		return txn.Put("name", []byte("Hippy"))
+	}); err != ErrIsClosed {
+		t.Fatalf("expected %v and received %v", ErrIsClosed, err)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- db.Shutdown(context.Background()) }()
+
+	close(release)
+	if err = <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Close(); err != ErrIsClosed {
+		t.Fatalf("expected %v and received %v", ErrIsClosed, err)
+	}
+
+	if db, err = New(tmpPath, "shutdown_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("greeting"); !ok || string(b) != "Hello!" {
+			t.Errorf("in-flight transaction was not committed: %s", b)
+		}
+		return
+	})
+
+	db.Close()
+	os.Remove(filepath.Join(tmpPath, "shutdown_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "shutdown_test.archive.hdb"))
+}
+
+func TestInMemory(t *testing.T) {
+	var (
+		b   []byte
+		ok  bool
+		id  uint64
+		seq *Sequence
+		db  *Hippy
+		err error
+	)
+
+	memOpts := opts
+	memOpts.InMemory = true
+
+	if db, err = New(tmpPath, "memory_test", memOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		if err = txn.Put("greeting", []byte("Hello!")); err != nil {
+			return
+		}
+
+		if err = txn.PutWithTTL("session", []byte("abc"), time.Hour); err != nil {
+			return
+		}
+
+		return txn.Bucket("users").Put("1", []byte("Hippy"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if seq, err = db.Sequence("ids"); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err = seq.Next(); err != nil || id != 1 {
+		t.Fatalf("invalid id: %d (%v)", id, err)
+	}
+
+	if _, err = os.Stat(filepath.Join(tmpPath, "memory_test.hdb")); !os.IsNotExist(err) {
+		t.Fatal("in-memory instance created a backing file")
+	}
+
+	if err = db.ChangesSince(0, func(Commit) error { return nil }); err != ErrInMemory {
+		t.Fatalf("expected %v and received %v", ErrInMemory, err)
+	}
+
+	snapshot := filepath.Join(tmpPath, "memory_test.snapshot")
+	if err = db.SaveTo(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load our snapshot into a persistent database which already contains data
+	if db, err = New(tmpPath, "memory_load_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Write(func(txn *WriteTx) (err error) {
+		txn.Bucket("stale").Put("1", []byte("stale"))
+		return txn.Put("stale", []byte("stale"))
+	})
+
+	if err = db.LoadFrom(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "memory_load_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("greeting"); !ok || string(b) != "Hello!" {
+			t.Errorf("invalid value: %s", b)
+		}
+
+		if b, ok = txn.Get("session"); !ok || string(b) != "abc" {
+			t.Errorf("invalid value: %s", b)
+		}
+
+		if b, ok = txn.Bucket("users").Get("1"); !ok || string(b) != "Hippy" {
+			t.Errorf("invalid bucket value: %s", b)
+		}
+
+		if _, ok = txn.Get("stale"); ok {
+			t.Error("existing key was not replaced by snapshot")
+		}
+
+		if len(txn.Buckets()) != 1 {
+			t.Errorf("invalid buckets: %v", txn.Buckets())
+		}
+		return
+	})
+
+	if seq, err = db.Sequence("ids"); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err = seq.Next(); err != nil || id <= 1 {
+		t.Fatalf("sequence re-issued id: %d (%v)", id, err)
+	}
+
+	db.Close()
+
+	// A truncated snapshot must be rejected
+	if b, err = ioutil.ReadFile(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(snapshot, b[:bytes.LastIndexByte(b[:len(b)-1], '\n')+1], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New(tmpPath, "memory_test", memOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.LoadFrom(snapshot); err != ErrInvalidSnapshot {
+		t.Fatalf("expected %v and received %v", ErrInvalidSnapshot, err)
+	}
+
+	db.Close()
+	os.Remove(snapshot)
+	os.Remove(filepath.Join(tmpPath, "memory_load_test.hdb"))
+	os.Remove(filepath.Join(tmpPath, "memory_load_test.archive.hdb"))
+}
+
+func TestBackends(t *testing.T) {
 	var (
 		b   []byte
 		ok  bool
+		n   int
+		ds  *DirStore
+		ab  *ObjectBackend
+		db  *Hippy
+		err error
+	)
+
+	dir := filepath.Join(tmpPath, "backends_test")
+	if ds, err = NewDirStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if ab, err = NewObjectBackend(ds, "archive."); err != nil {
+		t.Fatal(err)
+	}
+
+	fb := NewFaultBackend()
+	bOpts := opts
+	bOpts.LogBackend = fb
+	bOpts.ArchiveBackend = ab
+
+	for i := 0; i < 3; i++ {
+		if db, err = New("", "backends_test", bOpts); err != nil {
+			t.Fatal("Error opening:", err)
+		}
+
+		if err = db.Write(func(txn *WriteTx) (err error) {
+			return txn.Put(fmt.Sprintf("%d", i), []byte("Hello!"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db, err = New("", "backends_test", bOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if keys := txn.Keys(); len(keys) != 3 {
+			t.Errorf("invalid keys: %v", keys)
+		}
+		return
+	})
+
+	// Every commit must be available from our object backed archive
+	if err = db.ChangesSince(0, func(c Commit) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Fatalf("expected 3 commits and received %d", n)
+	}
+
+	fb.FailAfter(1)
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("a", []byte("a"))
+		return txn.Put("b", []byte("b"))
+	}); err != ErrInjectedFault {
+		t.Fatalf("expected %v and received %v", ErrInjectedFault, err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if _, ok = txn.Get("a"); ok {
+			t.Error("failed transaction was applied to memory")
+		}
+		return
+	})
+
+	// Simulate a crash, our unflushed lines are lost and our fault is cleared
+	fb.Crash(0, false)
+	if db, err = New("", "backends_test", bOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	db.Read(func(txn *ReadTx) (err error) {
+		if b, ok = txn.Get("2"); !ok || string(b) != "Hello!" {
+			t.Errorf("invalid value: %s", b)
+		}
+
+		if _, ok = txn.Get("a"); ok {
+			t.Error("failed transaction was recovered")
+		}
+		return
+	})
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingStore is an ObjectStore which counts the objects fetched from it
+type countingStore struct {
+	ObjectStore
+	gets int
+}
+
+// Get will return the contents of an object
+func (cs *countingStore) Get(name string) ([]byte, error) {
+	cs.gets++
+	return cs.ObjectStore.Get(name)
+}
+
+func TestObjectBackendCache(t *testing.T) {
+	var (
+		ds  *DirStore
+		ob  *ObjectBackend
+		n   int
+		err error
+	)
+
+	dir := filepath.Join(tmpPath, "object_cache_test")
+	if ds, err = NewDirStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs := &countingStore{ObjectStore: ds}
+	if ob, err = NewObjectBackend(cs, "archive."); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		ob.Append([]byte(fmt.Sprint(i)))
+		if err = ob.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Segments we have written are counted without being fetched
+	if n, err = countLines(ob); err != nil || n != 3 {
+		t.Fatalf("expected 3 lines and received %d: %v", n, err)
+	}
+
+	var ls []string
+	if err = ob.ReadFrom(2, func(b *bytes.Buffer) bool {
+		ls = append(ls, b.String())
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(ls) != "[2]" || cs.gets != 1 {
+		t.Fatalf("expected to fetch only our last segment and received %v after %d fetches", ls, cs.gets)
+	}
+
+	// A re-opened backend fetches each segment once to learn it's line count
+	if ob, err = NewObjectBackend(cs, "archive."); err != nil {
+		t.Fatal(err)
+	}
+
+	cs.gets = 0
+	for i := 0; i < 2; i++ {
+		if n, err = countLines(ob); err != nil || n != 3 {
+			t.Fatalf("expected 3 lines and received %d: %v", n, err)
+		}
+	}
+
+	if cs.gets != 3 {
+		t.Fatalf("expected 3 fetches and received %d", cs.gets)
+	}
+
+	// Truncation replaces our segments with a single base segment
+	if err = ob.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	cs.gets = 0
+	if n, err = countLines(ob); err != nil || n != 1 || cs.gets != 0 {
+		t.Fatalf("expected 1 line without fetching and received %d after %d fetches: %v", n, cs.gets, err)
+	}
+}
+
+func TestArchiveCompact(t *testing.T) {
+	var (
 		db  *Hippy
 		err error
 	)
 
-	if db, err = New(tmpPath, "medium_test", opts); err != nil {
-		fmt.Println("Error opening:", err)
-		return
+	lb, ab := NewMemoryBackend(), NewMemoryBackend()
+	mOpts := opts
+	mOpts.LogBackend = lb
+	mOpts.ArchiveBackend = ab
+	mOpts.ArchiveOnClose = false
+	mOpts.CompactOnClose = false
+
+	if db, err = New("", "archive_compact_test", mOpts); err != nil {
+		t.Fatal("Error opening:", err)
 	}
 
-	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
-		b, ok = txn.Get("greeting")
-		//	fmt.Println(string(b), ok)
+	for i := 0; i < 10; i++ {
+		if err = db.Write(func(txn *WriteTx) (err error) {
+			return txn.Put("counter", EncodeInt64(int64(i)))
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-		txn.Put("greeting", []byte(`Hello!`))
-		b, ok = txn.Get("greeting")
-		return
-	})
+	before := len(lb.Lines(0))
+	if err = db.Archive(); err != nil {
+		t.Fatal(err)
+	}
 
-	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
-		txn.Put("greeting", []byte("NO!!"))
-		b, ok = txn.Get("greeting")
-		return errors.New("Merp")
-	})
+	// Each transaction is a record followed by a commit
+	if n := len(ab.Lines(0)); n < 20 {
+		t.Fatalf("expected at least 20 archived lines and received %d", n)
+	}
 
-	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
-		if _, ok = txn.Get("greeting"); !ok {
-			t.Error("key isn't found")
+	if err = db.Archive(); err != ErrNoChanges {
+		t.Fatalf("expected %v and received %v", ErrNoChanges, err)
+	}
+
+	if err = db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := len(lb.Lines(0)); after >= before {
+		t.Fatalf("expected compaction to shrink the log from %d lines, received %d", before, after)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Compact(); err != ErrIsClosed {
+		t.Fatalf("expected %v and received %v", ErrIsClosed, err)
+	}
+
+	if db, err = New("", "archive_compact_test", mOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer db.Close()
+
+	db.Read(func(txn *ReadTx) error {
+		if b, _ := txn.Get("counter"); !bytes.Equal(b, EncodeInt64(9)) {
+			t.Errorf("invalid value after compaction: %v", b)
 		}
-		return
-	})
 
-	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
-		txn.Del("greeting")
-		return
+		return nil
 	})
+}
 
-	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
-		if _, ok = txn.Get("greeting"); ok {
-			t.Error("key was found")
+func TestStats(t *testing.T) {
+	var (
+		st  Stats
+		db  *Hippy
+		err error
+
+		errRejected = errors.New("rejected")
+	)
+
+	lb, ab := NewMemoryBackend(), NewMemoryBackend()
+	sOpts := opts
+	sOpts.LogBackend = lb
+	sOpts.ArchiveBackend = ab
+	sOpts.ArchiveOnClose = false
+	sOpts.CompactOnClose = false
+	sOpts.PreCommit = []PreCommitFunc{
+		func(es []Event) error {
+			for _, e := range es {
+				if e.Key == "reject" {
+					return errRejected
+				}
+			}
+
+			return nil
+		},
+	}
+
+	if db, err = New("", "stats_test", sOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("a", []byte("12345"))
+		txn.Put("b", []byte("123"))
+		return txn.Bucket("users").Put("name", []byte("hippy"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		txn.Del("b")
+		return txn.Put("a", []byte("1"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Write(func(txn *WriteTx) error {
+		return txn.Put("reject", []byte("1"))
+	}); err != errRejected {
+		t.Fatalf("expected %v and received %v", errRejected, err)
+	}
+
+	db.Read(func(txn *ReadTx) error { return nil })
+
+	st = db.Stats()
+	if st.Keys != 1 || st.Buckets != 1 || st.BucketKeys != 1 {
+		t.Fatalf("invalid key counts: %d keys, %d buckets, %d bucket keys", st.Keys, st.Buckets, st.BucketKeys)
+	}
+
+	if st.ValueBytes != 6 {
+		t.Fatalf("expected 6 value bytes and received %d", st.ValueBytes)
+	}
+
+	if st.Commits != 2 || st.FailedCommits != 1 {
+		t.Fatalf("expected 2 commits and 1 failed commit, received %d and %d", st.Commits, st.FailedCommits)
+	}
+
+	if st.Records != 5 {
+		t.Fatalf("expected 5 records and received %d", st.Records)
+	}
+
+	if st.LogSize <= 0 || st.ArchiveSize != 0 {
+		t.Fatalf("invalid sizes: log %d, archive %d", st.LogSize, st.ArchiveSize)
+	}
+
+	if st.FlushLatency.Count < 2 || st.WriteLockWait.Count < 3 || st.ReadLockWait.Count < 1 {
+		t.Fatalf("invalid histogram counts: flush %d, write lock %d, read lock %d",
+			st.FlushLatency.Count, st.WriteLockWait.Count, st.ReadLockWait.Count)
+	}
+
+	var n uint64
+	for _, c := range st.FlushLatency.Counts {
+		n += c
+	}
+
+	if n != st.FlushLatency.Count || len(st.FlushLatency.Counts) != len(st.FlushLatency.Bounds)+1 {
+		t.Fatalf("invalid histogram: %+v", st.FlushLatency)
+	}
+
+	if err = db.Write(func(txn *WriteTx) error {
+		return txn.DeleteBucket("users")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if st = db.Stats(); st.Records != 0 || st.ValueBytes != 1 || st.Buckets != 0 {
+		t.Fatalf("invalid stats after compaction: %d records, %d value bytes, %d buckets", st.Records, st.ValueBytes, st.Buckets)
+	}
+
+	if st.CompactDuration.Count != 1 || st.BytesWritten <= st.LogSize {
+		t.Fatalf("invalid stats after compaction: %d compactions, %d bytes written", st.CompactDuration.Count, st.BytesWritten)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = New("", "stats_test", sOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer db.Close()
+
+	if st = db.Stats(); st.Records != 0 || st.ValueBytes != 1 || st.Commits != 0 {
+		t.Fatalf("invalid stats after re-opening: %d records, %d value bytes, %d commits", st.Records, st.ValueBytes, st.Commits)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var (
+		ts  []Trace
+		db  *Hippy
+		err error
+	)
+
+	lb, ab := NewMemoryBackend(), NewMemoryBackend()
+	l := &testLogger{}
+	tOpts := opts
+	tOpts.LogBackend = lb
+	tOpts.ArchiveBackend = ab
+	tOpts.ArchiveOnClose = false
+	tOpts.CompactOnClose = false
+	tOpts.Logger = l
+	tOpts.Trace = []TraceFunc{
+		func(tr Trace) {
+			ts = append(ts, tr)
+		},
+	}
+
+	if db, err = New("", "trace_test", tOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	ts = ts[:0]
+	if err = db.Write(func(txn *WriteTx) (err error) {
+		txn.Put("name", []byte("hippy"))
+		return txn.Bucket("users").Put("1", []byte("potamus"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Read(func(txn *ReadTx) error { return nil })
+
+	if err = db.Archive(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Archive(); err != ErrNoChanges {
+		t.Fatalf("expected %v and received %v", ErrNoChanges, err)
+	}
+
+	if err = db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []TraceOp{TraceBegin, TraceFlush, TraceCommit, TraceBegin, TraceFlush, TraceArchive, TraceArchive, TraceCompact}
+	if len(ts) != len(exp) {
+		t.Fatalf("expected %d traces and received %d: %+v", len(exp), len(ts), ts)
+	}
+
+	for i, tr := range ts {
+		if tr.Op != exp[i] {
+			t.Fatalf("expected trace %d to be %v and received %v", i, exp[i], tr.Op)
 		}
-		return
-	})
+	}
 
-	db.ReadWrite(func(txn *ReadWriteTx) (err error) {
-		txn.Put("greeting", []byte("Hello!"))
-		return
-	})
+	if tr := ts[0]; !tr.Writable {
+		t.Errorf("expected a writable begin: %+v", tr)
+	}
 
-	db.Close()
-	os.Remove(filepath.Join(tmpPath, "medium_test.hdb"))
+	if tr := ts[2]; tr.Keys != 2 || tr.Seq != 1 || tr.Err != nil || tr.Duration <= 0 {
+		t.Errorf("invalid commit trace: %+v", tr)
+	}
+
+	if tr := ts[3]; tr.Writable {
+		t.Errorf("expected a read-only begin: %+v", tr)
+	}
+
+	if tr := ts[5]; tr.Lines == 0 || tr.Err != nil {
+		t.Errorf("invalid archive trace: %+v", tr)
+	}
+
+	if tr := ts[6]; tr.Err != ErrNoChanges {
+		t.Errorf("invalid archive trace: %+v", tr)
+	}
+
+	if tr := ts[7]; tr.Keys != 2 || tr.Lines == 0 || tr.Err != nil {
+		t.Errorf("invalid compaction trace: %+v", tr)
+	}
+
+	if len(l.msgs) != 0 {
+		t.Fatalf("expected no messages and received %v", l.msgs)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tear our final line, it is discarded when replayed
+	lb.Append([]byte("torn"))
+	lb.Flush()
+
+	if db, err = New("", "trace_test", tOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !l.has("warn", "log ends with an invalid line") {
+		t.Fatalf("expected a warning for our torn line: %v", l.msgs)
+	}
+
+	// Corrupt a line within our log
+	lb.Append([]byte("corrupt"))
+	lb.Append(lb.Lines(0)[0])
+	lb.Flush()
+
+	var lerr *LineError
+	if _, err = New("", "trace_test", tOpts); !errors.As(err, &lerr) {
+		t.Fatalf("expected a line error and received %v", err)
+	}
+
+	if !l.has("error", "replay failed") {
+		t.Fatalf("expected an error for our corrupt line: %v", l.msgs)
+	}
+}
+
+// testLogger is a Logger which records the level and message of every message
+type testLogger struct {
+	msgs []string
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) {}
+
+func (l *testLogger) Info(msg string, args ...interface{}) { l.msgs = append(l.msgs, "info: "+msg) }
+
+func (l *testLogger) Warn(msg string, args ...interface{}) { l.msgs = append(l.msgs, "warn: "+msg) }
+
+func (l *testLogger) Error(msg string, args ...interface{}) { l.msgs = append(l.msgs, "error: "+msg) }
+
+// has will return whether or not a message was recorded with the provided level
+func (l *testLogger) has(level, msg string) bool {
+	for _, m := range l.msgs {
+		if m == level+": "+msg {
+			return true
+		}
+	}
+
+	return false
 }
 
 func BenchmarkShortHippy(b *testing.B) {
@@ -336,12 +2179,11 @@ func BenchmarkAllGetBolt(b *testing.B) {
 }
 
 func hippyRW(db *Hippy, iter int) (err error) {
-	var bb []byte
 	return db.ReadWrite(func(txn *ReadWriteTx) (err error) {
 		for i := 0; i < iter; i++ {
 			for _, k := range testKeys {
 				txn.Put(k, testVal)
-				bb, _ = txn.Get(k)
+				txn.Get(k)
 			}
 		}
 		return
@@ -349,11 +2191,10 @@ func hippyRW(db *Hippy, iter int) (err error) {
 }
 
 func hippyR(db *Hippy, iter int) (err error) {
-	var bb []byte
 	return db.Read(func(txn *ReadTx) (err error) {
 		for i := 0; i < iter; i++ {
 			for _, k := range testKeys {
-				bb, _ = txn.Get(k)
+				txn.Get(k)
 			}
 		}
 		return
@@ -390,13 +2231,12 @@ func mapR(db *LMap, iter int) (err error) {
 }
 
 func boltRW(bdb *bolt.DB, iter int) (err error) {
-	var bb []byte
 	return bdb.Update(func(tx *bolt.Tx) (err error) {
 		bkt := tx.Bucket(boltBktKey)
 		for i := 0; i < iter; i++ {
 			for _, k := range testKeysB {
 				bkt.Put(k, testVal)
-				bb = bkt.Get(k)
+				bkt.Get(k)
 			}
 		}
 		return
@@ -404,12 +2244,11 @@ func boltRW(bdb *bolt.DB, iter int) (err error) {
 }
 
 func boltR(bdb *bolt.DB, iter int) (err error) {
-	var bb []byte
 	return bdb.View(func(tx *bolt.Tx) (err error) {
 		bkt := tx.Bucket(boltBktKey)
 		for i := 0; i < iter; i++ {
 			for _, k := range testKeysB {
-				bb = bkt.Get(k)
+				bkt.Get(k)
 			}
 		}
 		return
@@ -438,3 +2277,125 @@ func (l *LMap) Put(k string, v []byte) {
 	l.m[k] = v
 	l.mux.Unlock()
 }
+
+func TestExportImport(t *testing.T) {
+	var (
+		src, dst *Hippy
+		n        int
+		err      error
+	)
+
+	memOpts := opts
+	memOpts.InMemory = true
+
+	if src, err = New("", "export_test", memOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer src.Close()
+
+	if err = src.Write(func(txn *WriteTx) (err error) {
+		if err = txn.Put("greeting", []byte("Hello, \"world\" <&>")); err != nil {
+			return
+		}
+
+		if err = txn.PutWithTTL("session", []byte("abc"), time.Hour); err != nil {
+			return
+		}
+
+		return txn.Bucket("users").Put("1", []byte("Hippy,\nPotamus"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []Format{FormatJSON, FormatJSONRaw, FormatCSV} {
+		var exp, got bytes.Buffer
+		if err = src.Export(&exp, f); err != nil {
+			t.Fatal(err)
+		}
+
+		if dst, err = New("", "import_test", memOpts); err != nil {
+			t.Fatal("Error opening:", err)
+		}
+
+		if n, err = dst.Import(bytes.NewReader(exp.Bytes()), f, ImportOpts{BatchSize: 2}); err != nil || n != 3 {
+			t.Fatalf("format %d: expected 3 records and received %d (%v)", f, n, err)
+		}
+
+		if err = dst.Export(&got, f); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.String() != exp.String() {
+			t.Errorf("format %d: import does not match export:\n%s\n%s", f, exp.String(), got.String())
+		}
+
+		dst.Close()
+	}
+
+	if err = src.Export(ioutil.Discard, Format(99)); err != ErrInvalidFormat {
+		t.Fatalf("expected %v and received %v", ErrInvalidFormat, err)
+	}
+
+	if dst, err = New("", "import_test", memOpts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer dst.Close()
+
+	lines := strings.Join([]string{
+		`{"key":"a","value":"YQ=="}`,
+		`{"key":"b",`,
+		`{"key":"c"}`,
+		`{"key":"` + strings.Repeat("k", MaxKeyLen+1) + `","value":"YQ=="}`,
+		``,
+		`{"key":"expired","value":"YQ==","expires":"2000-01-01T00:00:00Z"}`,
+		`{"key":"f","value":"YQ=="}`,
+	}, "\n")
+
+	// Invalid lines are reported and skipped
+	n, err = dst.Import(strings.NewReader(lines), FormatJSON, ImportOpts{BatchSize: 1})
+	if n != 2 {
+		t.Fatalf("expected 2 records and received %d", n)
+	}
+
+	errs, _ := err.(ErrorList)
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 line errors and received %v", err)
+	}
+
+	for i, line := range []int{2, 3, 4} {
+		if lerr, ok := errs[i].(*LineError); !ok || lerr.Line != line {
+			t.Errorf("expected an error for line %d and received %v", line, errs[i])
+		}
+	}
+
+	// Importing stops at the first invalid line
+	n, err = dst.Import(strings.NewReader(lines), FormatJSON, ImportOpts{StopOnError: true})
+	if errs, _ = err.(ErrorList); n != 0 || len(errs) != 1 {
+		t.Fatalf("expected no records and a single error, received %d (%v)", n, err)
+	}
+
+	// CSV columns are matched by the header
+	csvLines := "value,key\nx,csv1\nshort\ny,csv2\n"
+	n, err = dst.Import(strings.NewReader(csvLines), FormatCSV, ImportOpts{})
+	if errs, _ = err.(ErrorList); n != 2 || len(errs) != 1 || errs[0].(*LineError).Line != 3 {
+		t.Fatalf("expected 2 records and an error for line 3, received %d (%v)", n, err)
+	}
+
+	if _, err = dst.Import(strings.NewReader("a,b\n1,2\n"), FormatCSV, ImportOpts{}); err == nil {
+		t.Fatal("expected an error for an invalid header")
+	}
+
+	dst.Read(func(txn *ReadTx) error {
+		for _, k := range []string{"a", "f", "csv1", "csv2"} {
+			if _, ok := txn.Get(k); !ok {
+				t.Errorf("key %s was not imported", k)
+			}
+		}
+
+		if _, ok := txn.Get("expired"); ok {
+			t.Error("expired key was imported")
+		}
+
+		return nil
+	})
+}
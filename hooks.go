@@ -0,0 +1,33 @@
+package hippy
+
+// PreCommitFunc is called with the pending changes of a transaction before anything is written to disk.
+// Returning an error will abort the transaction and the error will be returned to the caller
+// Note: Hooks are called while the database is locked and must not call back into the database
+type PreCommitFunc func(events []Event) error
+
+// PostCommitFunc is called with the changes of a transaction after they have been successfully flushed to disk
+// Note: Hooks are called while the database is locked and must not call back into the database
+type PostCommitFunc func(c Commit)
+
+// hasHooks will return whether or not any commit hooks are registered
+func (h *Hippy) hasHooks() bool {
+	return len(h.opts.PreCommit) > 0 || len(h.opts.PostCommit) > 0
+}
+
+// preCommit will call the pre-commit hooks in order, stopping at the first error
+func (h *Hippy) preCommit(es []Event) (err error) {
+	for _, fn := range h.opts.PreCommit {
+		if err = fn(es); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// postCommit will call the post-commit hooks in order
+func (h *Hippy) postCommit(c Commit) {
+	for _, fn := range h.opts.PostCommit {
+		fn(c)
+	}
+}
@@ -0,0 +1,138 @@
+package hippy
+
+import (
+	"sort"
+	"time"
+)
+
+// IndexFunc returns the index terms for a key and value
+type IndexFunc func(key string, val []byte) []string
+
+// newIndex returns a new index for the provided extractor
+func newIndex(fn IndexFunc) *index {
+	return &index{
+		fn:    fn,
+		terms: make(map[string]map[string]struct{}),
+		keys:  make(map[string][]string),
+	}
+}
+
+// index is an in-memory secondary index of the root keyspace
+type index struct {
+	// Term extractor
+	fn IndexFunc
+
+	terms  map[string]map[string]struct{} // Keys by term
+	keys   map[string][]string            // Terms by key
+	sorted []string                       // Terms in sorted order
+}
+
+// put will index a key and value, replacing any previous terms for the key
+func (idx *index) put(key string, val []byte) {
+	idx.del(key)
+
+	terms := idx.fn(key, val)
+	if len(terms) == 0 {
+		return
+	}
+
+	idx.keys[key] = terms
+	for _, term := range terms {
+		ks, ok := idx.terms[term]
+		if !ok {
+			ks = make(map[string]struct{})
+			idx.terms[term] = ks
+			idx.insertTerm(term)
+		}
+
+		ks[key] = struct{}{}
+	}
+}
+
+// del will remove a key from the index
+func (idx *index) del(key string) {
+	terms, ok := idx.keys[key]
+	if !ok {
+		return
+	}
+
+	delete(idx.keys, key)
+	for _, term := range terms {
+		ks := idx.terms[term]
+		delete(ks, key)
+
+		if len(ks) == 0 {
+			delete(idx.terms, term)
+			idx.removeTerm(term)
+		}
+	}
+}
+
+// insertTerm will insert a term into the sorted terms list
+func (idx *index) insertTerm(term string) {
+	i := sort.SearchStrings(idx.sorted, term)
+	idx.sorted = append(idx.sorted, "")
+	copy(idx.sorted[i+1:], idx.sorted[i:])
+	idx.sorted[i] = term
+}
+
+// removeTerm will remove a term from the sorted terms list
+func (idx *index) removeTerm(term string) {
+	i := sort.SearchStrings(idx.sorted, term)
+	if i == len(idx.sorted) || idx.sorted[i] != term {
+		return
+	}
+
+	idx.sorted = append(idx.sorted[:i], idx.sorted[i+1:]...)
+}
+
+// Index is a read-only view of a secondary index
+// Note: Indexes reflect committed data, changes made within a read/write transaction are not visible until commit
+type Index struct {
+	// Pointer to our DB's internal store
+	h *Hippy
+	// Pointer to the underlying index, nil when the index does not exist
+	idx *index
+}
+
+// Get will return the keys indexed by the provided term, in key order
+func (i *Index) Get(term string) (keys []string) {
+	if i.idx == nil {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	for k := range i.idx.terms[term] {
+		if i.h.isExpired(k, now) {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return
+}
+
+// Range will call the provided func for every term and key within the range of [start, end), in term order
+// Note: An empty end will iterate through the remainder of the index. Iteration will end early if the provided func returns an error
+func (i *Index) Range(start, end string, fn func(term, key string) error) (err error) {
+	if i.idx == nil {
+		return
+	}
+
+	for n := sort.SearchStrings(i.idx.sorted, start); n < len(i.idx.sorted); n++ {
+		term := i.idx.sorted[n]
+		if len(end) > 0 && term >= end {
+			return
+		}
+
+		for _, k := range i.Get(term) {
+			if err = fn(term, k); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
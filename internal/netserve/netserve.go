@@ -0,0 +1,151 @@
+// Package netserve accepts and tracks the listeners and connections of a TCP server, so that closing the server closes
+// every listener and connection and waits for their handlers to return
+package netserve
+
+import (
+	"net"
+	"sync"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+// ErrIsClosed is returned when an action is attempted on a closed server
+const ErrIsClosed = errors.Error("cannot perform action on closed server")
+
+// New returns a new server which serves each accepted connection with the provided handler
+// Note: Connections are closed once their handler returns
+func New(handle func(net.Conn)) *Server {
+	return &Server{
+		handle: handle,
+		lns:    make(map[net.Listener]struct{}),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Server accepts connections and tracks them until they are closed
+type Server struct {
+	mux sync.Mutex
+	wg  sync.WaitGroup
+
+	handle func(net.Conn) // Connection handler
+
+	lns   map[net.Listener]struct{} // Active listeners
+	conns map[net.Conn]struct{}     // Active connections
+
+	closed bool // Closed state
+}
+
+// ListenAndServe will listen on the provided TCP address and serve incoming connections
+func (s *Server) ListenAndServe(addr string) (err error) {
+	var ln net.Listener
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve will serve incoming connections from the provided listener until the listener or server is closed
+// Note: Serve returns nil once the server has been closed
+func (s *Server) Serve(ln net.Listener) (err error) {
+	if !s.track(ln) {
+		ln.Close()
+		return ErrIsClosed
+	}
+
+	defer s.untrack(ln)
+
+	for {
+		var conn net.Conn
+		if conn, err = ln.Accept(); err != nil {
+			if s.isClosed() {
+				err = nil
+			}
+
+			return
+		}
+
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close will close all listeners and connections, and wait for their handlers to return
+func (s *Server) Close() (err error) {
+	var errs hippy.ErrorList
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return ErrIsClosed
+	}
+
+	s.closed = true
+	for ln := range s.lns {
+		errs.Push(ln.Close())
+	}
+
+	for conn := range s.conns {
+		// Connections may be closing on their own, their errors are not of interest
+		conn.Close()
+	}
+	s.mux.Unlock()
+
+	s.wg.Wait()
+	return errs.Err()
+}
+
+// serveConn will call our handler for a connection, and close the connection once the handler returns
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrackConn(conn)
+	s.handle(conn)
+}
+
+// track will add a listener to our active listeners, false is returned if the server has been closed
+func (s *Server) track(ln net.Listener) (ok bool) {
+	s.mux.Lock()
+	if ok = !s.closed; ok {
+		s.lns[ln] = struct{}{}
+	}
+	s.mux.Unlock()
+	return
+}
+
+// untrack will remove a listener from our active listeners
+func (s *Server) untrack(ln net.Listener) {
+	s.mux.Lock()
+	delete(s.lns, ln)
+	s.mux.Unlock()
+}
+
+// trackConn will add a connection to our active connections, false is returned if the server has been closed
+func (s *Server) trackConn(conn net.Conn) (ok bool) {
+	s.mux.Lock()
+	if ok = !s.closed; ok {
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+	}
+	s.mux.Unlock()
+	return
+}
+
+// untrackConn will close a connection and remove it from our active connections
+func (s *Server) untrackConn(conn net.Conn) {
+	conn.Close()
+	s.mux.Lock()
+	delete(s.conns, conn)
+	s.mux.Unlock()
+}
+
+// isClosed will return whether or not the server has been closed
+func (s *Server) isClosed() (closed bool) {
+	s.mux.Lock()
+	closed = s.closed
+	s.mux.Unlock()
+	return
+}
@@ -0,0 +1,333 @@
+// Package wire implements the length-prefixed protocol spoken between the hippy server and client
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// OpGet will get the value of a key
+	OpGet OpType = iota + 1
+	// OpPut will put the value of a key
+	OpPut
+	// OpDel will delete a key
+	OpDel
+	// OpKeys will list the keys with the prefix provided as the op key
+	OpKeys
+)
+
+const (
+	// StatusOK is the status of a response whose batch was committed
+	StatusOK byte = iota
+	// StatusError is the status of a response whose batch failed, the response body is the error message
+	StatusError
+)
+
+const (
+	// MaxFrameLen is the maximum length of a frame
+	MaxFrameLen = 64 * 1024 * 1024
+	// MaxKeyLen is the maximum length of a key
+	MaxKeyLen = 255
+
+	// resultLen is the minimum encoded length of a result
+	resultLen = 9
+)
+
+const (
+	// ErrFrameTooLarge is returned when a frame exceeds the maximum frame length
+	ErrFrameTooLarge = errors.Error("frame is too large")
+	// ErrInvalidFrame is returned when a frame cannot be decoded
+	ErrInvalidFrame = errors.Error("invalid frame")
+	// ErrInvalidOp is returned when an op type is not recognized
+	ErrInvalidOp = errors.Error("invalid op")
+	// ErrInvalidKey is returned when a key exceeds the maximum key length
+	ErrInvalidKey = errors.Error("invalid key")
+)
+
+// OpType is the type of an operation
+type OpType uint8
+
+// Op is an operation within a request batch
+type Op struct {
+	Type  OpType
+	Key   string
+	Value []byte // Value for PUT operations
+}
+
+// Result is the result of an operation
+type Result struct {
+	OK    bool     // Key exists, set for GET operations
+	Value []byte   // Value for GET operations
+	Keys  []string // Keys for KEYS operations
+}
+
+// WriteFrame will write a length-prefixed frame
+func WriteFrame(w io.Writer, b []byte) (err error) {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+	if _, err = w.Write(l[:]); err != nil {
+		return
+	}
+
+	_, err = w.Write(b)
+	return
+}
+
+// ReadFrame will read a length-prefixed frame, re-using the provided buffer when possible
+func ReadFrame(r io.Reader, buf []byte) (b []byte, err error) {
+	var l [4]byte
+	if _, err = io.ReadFull(r, l[:]); err != nil {
+		return
+	}
+
+	n := binary.BigEndian.Uint32(l[:])
+	if n > MaxFrameLen {
+		err = ErrFrameTooLarge
+		return
+	}
+
+	if cap(buf) < int(n) {
+		buf = make([]byte, n)
+	}
+
+	b = buf[:n]
+	if _, err = io.ReadFull(r, b); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return
+}
+
+// EncodeRequest will encode a request batch
+func EncodeRequest(ops []Op) (b []byte, err error) {
+	b = appendUint32(b, uint32(len(ops)))
+	for _, op := range ops {
+		if len(op.Key) > MaxKeyLen {
+			err = ErrInvalidKey
+			return
+		}
+
+		b = append(b, byte(op.Type), uint8(len(op.Key)))
+		b = append(b, op.Key...)
+		if op.Type == OpPut {
+			b = appendBytes(b, op.Value)
+		}
+	}
+
+	return
+}
+
+// DecodeRequest will decode a request batch, values are copied and do not reference the provided buffer
+func DecodeRequest(b []byte) (ops []Op, err error) {
+	var (
+		n uint32
+		d = decoder{b: b}
+	)
+
+	if n, err = d.uint32(); err != nil {
+		return
+	}
+
+	for i := uint32(0); i < n; i++ {
+		var (
+			op Op
+			t  []byte
+			kl []byte
+			k  []byte
+		)
+
+		if t, err = d.next(1); err != nil {
+			return
+		}
+
+		if op.Type = OpType(t[0]); op.Type < OpGet || op.Type > OpKeys {
+			err = ErrInvalidOp
+			return
+		}
+
+		if kl, err = d.next(1); err != nil {
+			return
+		}
+
+		if k, err = d.next(int(kl[0])); err != nil {
+			return
+		}
+
+		op.Key = string(k)
+		if op.Type == OpPut {
+			if op.Value, err = d.bytes(); err != nil {
+				return
+			}
+		}
+
+		ops = append(ops, op)
+	}
+
+	err = d.done()
+	return
+}
+
+// EncodeResponse will encode the response to a request batch, the results are ignored when an error is provided
+func EncodeResponse(rs []Result, rerr error) (b []byte) {
+	if rerr != nil {
+		b = append(b, StatusError)
+		return append(b, rerr.Error()...)
+	}
+
+	b = append(b, StatusOK)
+	b = appendUint32(b, uint32(len(rs)))
+	for _, r := range rs {
+		var ok byte
+		if r.OK {
+			ok = 1
+		}
+
+		b = append(b, ok)
+		b = appendBytes(b, r.Value)
+		b = appendUint32(b, uint32(len(r.Keys)))
+		for _, k := range r.Keys {
+			b = append(b, uint8(len(k)))
+			b = append(b, k...)
+		}
+	}
+
+	return
+}
+
+// DecodeResponse will decode the response to a request batch. An error response is returned as an errors.Error,
+// allowing it to be compared against the exported errors of the hippy package
+func DecodeResponse(b []byte) (rs []Result, err error) {
+	var (
+		n uint32
+		s []byte
+		d = decoder{b: b}
+	)
+
+	if s, err = d.next(1); err != nil {
+		return
+	}
+
+	if s[0] == StatusError {
+		err = errors.Error(d.b)
+		return
+	}
+
+	if n, err = d.uint32(); err != nil {
+		return
+	}
+
+	if uint64(n) > uint64(len(d.b)/resultLen) {
+		// Our frame is too short to contain the provided number of results
+		err = ErrInvalidFrame
+		return
+	}
+
+	rs = make([]Result, n)
+	for i := range rs {
+		var (
+			ok []byte
+			nk uint32
+		)
+
+		if ok, err = d.next(1); err != nil {
+			return
+		}
+
+		rs[i].OK = ok[0] == 1
+		if rs[i].Value, err = d.bytes(); err != nil {
+			return
+		}
+
+		if nk, err = d.uint32(); err != nil {
+			return
+		}
+
+		for j := uint32(0); j < nk; j++ {
+			var kl, k []byte
+			if kl, err = d.next(1); err != nil {
+				return
+			}
+
+			if k, err = d.next(int(kl[0])); err != nil {
+				return
+			}
+
+			rs[i].Keys = append(rs[i].Keys, string(k))
+		}
+	}
+
+	err = d.done()
+	return
+}
+
+// appendUint32 will append a big-endian uint32
+func appendUint32(b []byte, n uint32) []byte {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], n)
+	return append(b, l[:]...)
+}
+
+// appendBytes will append a length-prefixed byte slice
+func appendBytes(b, v []byte) []byte {
+	b = appendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
+
+// decoder decodes the fields of a frame
+type decoder struct {
+	b []byte
+}
+
+// next will return the next n bytes
+func (d *decoder) next(n int) (b []byte, err error) {
+	if n < 0 || n > len(d.b) {
+		err = ErrInvalidFrame
+		return
+	}
+
+	b = d.b[:n]
+	d.b = d.b[n:]
+	return
+}
+
+// uint32 will return the next big-endian uint32
+func (d *decoder) uint32() (n uint32, err error) {
+	var b []byte
+	if b, err = d.next(4); err != nil {
+		return
+	}
+
+	n = binary.BigEndian.Uint32(b)
+	return
+}
+
+// bytes will return a copy of the next length-prefixed byte slice
+func (d *decoder) bytes() (v []byte, err error) {
+	var (
+		n uint32
+		b []byte
+	)
+
+	if n, err = d.uint32(); err != nil {
+		return
+	}
+
+	if b, err = d.next(int(n)); err != nil {
+		return
+	}
+
+	v = append([]byte(nil), b...)
+	return
+}
+
+// done will ensure the frame has been consumed in full
+func (d *decoder) done() error {
+	if len(d.b) > 0 {
+		return ErrInvalidFrame
+	}
+
+	return nil
+}
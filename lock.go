@@ -0,0 +1,66 @@
+package hippy
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// ErrLocked is returned when a database is already opened by another process
+	ErrLocked = errors.Error("database is locked by another process")
+)
+
+// lockRetryInterval is the interval between lock attempts while waiting on a lock
+const lockRetryInterval = time.Millisecond * 10
+
+// newFileLock will acquire an exclusive advisory lock for the provided path and name. When the lock is held by another process,
+// acquisition is retried until the timeout has elapsed. ErrLocked is returned if the lock cannot be acquired
+func newFileLock(path, name string, timeout time.Duration) (fl *fileLock, err error) {
+	var f *os.File
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return
+	}
+
+	if f, err = os.OpenFile(filepath.Join(path, name+".lock"), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if err = tryLock(f); err != ErrLocked || !time.Now().Before(deadline) {
+			break
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	fl = &fileLock{f: f}
+	return
+}
+
+// fileLock is an advisory, inter-process lock backed by a lock file
+type fileLock struct {
+	f *os.File
+}
+
+// release will release the lock
+func (fl *fileLock) release() (err error) {
+	if fl == nil {
+		return
+	}
+
+	if err = unlock(fl.f); err != nil {
+		fl.f.Close()
+		return
+	}
+
+	return fl.f.Close()
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package hippy
+
+import "os"
+
+// tryLock is a no-op on platforms without flock support
+// Note: Inter-process locking is not enforced on these platforms
+func tryLock(f *os.File) error {
+	return nil
+}
+
+// unlock is a no-op on platforms without flock support
+func unlock(f *os.File) error {
+	return nil
+}
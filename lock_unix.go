@@ -0,0 +1,23 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package hippy
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock will attempt to acquire an exclusive lock on the provided file without blocking
+func tryLock(f *os.File) (err error) {
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		err = ErrLocked
+	}
+
+	return
+}
+
+// unlock will release a lock on the provided file
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
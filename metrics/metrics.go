@@ -0,0 +1,230 @@
+// Package metrics renders the statistics of Hippy databases in the Prometheus text exposition format, see Hippy.Stats.
+// The handler may be mounted within an existing server and scraped directly, no metrics library is required.
+//
+// Every sample is labelled with the name it's database was registered with, for example:
+//
+//	hippy_commits_total{db="users"} 42
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// DefaultNamespace is the default prefix of every metric name
+	DefaultNamespace = "hippy"
+	// ContentType is the content type of the Prometheus text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+const (
+	// ErrInvalidName is returned when registering a database without a name
+	ErrInvalidName = errors.Error("invalid database name")
+	// ErrIsRegistered is returned when registering a database with a name which is already registered
+	ErrIsRegistered = errors.Error("database is already registered")
+)
+
+// New returns a new handler without any registered databases
+func New() *Handler {
+	return &Handler{
+		dbs:       make(map[string]*hippy.Hippy),
+		Namespace: DefaultNamespace,
+	}
+}
+
+// Handler is an http.Handler which renders the statistics of it's registered databases
+type Handler struct {
+	mux sync.RWMutex
+	dbs map[string]*hippy.Hippy
+
+	// Prefix of every metric name
+	Namespace string
+}
+
+// Register will register a database under the provided name, it's statistics are rendered until it is unregistered
+func (h *Handler) Register(name string, db *hippy.Hippy) (err error) {
+	if len(name) == 0 {
+		return ErrInvalidName
+	}
+
+	h.mux.Lock()
+	if _, ok := h.dbs[name]; ok {
+		err = ErrIsRegistered
+	} else {
+		h.dbs[name] = db
+	}
+	h.mux.Unlock()
+	return
+}
+
+// Unregister will unregister the database with the provided name
+func (h *Handler) Unregister(name string) {
+	h.mux.Lock()
+	delete(h.dbs, name)
+	h.mux.Unlock()
+}
+
+// ServeHTTP will serve an HTTP request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	h.WriteTo(w)
+}
+
+// WriteTo will write the statistics of every registered database to the provided writer
+func (h *Handler) WriteTo(w io.Writer) (n int64, err error) {
+	var (
+		buf bytes.Buffer
+		ss  []stats
+	)
+
+	h.mux.RLock()
+	for name, db := range h.dbs {
+		ss = append(ss, stats{label: escape(name), s: db.Stats()})
+	}
+	h.mux.RUnlock()
+
+	// Render our databases in a consistent order
+	sort.Slice(ss, func(i, j int) bool { return ss[i].label < ss[j].label })
+
+	for _, m := range metrics {
+		name := h.Namespace + "_" + m.name
+		buf.WriteString("# HELP " + name + " " + m.help + "\n")
+		buf.WriteString("# TYPE " + name + " " + m.kind + "\n")
+		for _, s := range ss {
+			if m.hist != nil {
+				writeHistogram(&buf, name, s.label, m.hist(&s.s))
+			} else if v, ok := m.value(&s.s); ok {
+				writeSample(&buf, name, `db="`+s.label+`"`, v)
+			}
+		}
+	}
+
+	return buf.WriteTo(w)
+}
+
+// stats are the statistics of a database and it's escaped label value
+type stats struct {
+	label string
+	s     hippy.Stats
+}
+
+// metric is a metric rendered for every database, histograms set hist while gauges and counters set value
+type metric struct {
+	name string
+	help string
+	kind string
+
+	value func(*hippy.Stats) (v float64, ok bool)
+	hist  func(*hippy.Stats) hippy.Histogram
+}
+
+// metrics are the metrics we render, in order
+var metrics = []metric{
+	{name: "keys", help: "Number of root keys.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.Keys), true
+	}},
+	{name: "buckets", help: "Number of buckets.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.Buckets), true
+	}},
+	{name: "bucket_keys", help: "Number of keys across all buckets.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.BucketKeys), true
+	}},
+	{name: "value_bytes", help: "Total length of all values in bytes.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.ValueBytes), true
+	}},
+	{name: "log_size_bytes", help: "Size of the log in bytes.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		// Backends which do not report their size are omitted
+		return float64(s.LogSize), s.LogSize >= 0
+	}},
+	{name: "archive_size_bytes", help: "Size of the archive in bytes.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.ArchiveSize), s.ArchiveSize >= 0
+	}},
+	{name: "log_records", help: "Records written to the log since it was last compacted.", kind: "gauge", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.Records), true
+	}},
+	{name: "written_bytes_total", help: "Bytes appended to the log.", kind: "counter", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.BytesWritten), true
+	}},
+	{name: "commits_total", help: "Committed transactions.", kind: "counter", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.Commits), true
+	}},
+	{name: "failed_commits_total", help: "Transactions which failed to commit.", kind: "counter", value: func(s *hippy.Stats) (float64, bool) {
+		return float64(s.FailedCommits), true
+	}},
+	{name: "flush_duration_seconds", help: "Time taken to flush the log.", kind: "histogram", hist: func(s *hippy.Stats) hippy.Histogram {
+		return s.FlushLatency
+	}},
+	{name: "archive_duration_seconds", help: "Time taken to archive the log.", kind: "histogram", hist: func(s *hippy.Stats) hippy.Histogram {
+		return s.ArchiveDuration
+	}},
+	{name: "compaction_duration_seconds", help: "Time taken to compact the log.", kind: "histogram", hist: func(s *hippy.Stats) hippy.Histogram {
+		return s.CompactDuration
+	}},
+	{name: "read_lock_wait_seconds", help: "Time read transactions waited to acquire the lock.", kind: "histogram", hist: func(s *hippy.Stats) hippy.Histogram {
+		return s.ReadLockWait
+	}},
+	{name: "write_lock_wait_seconds", help: "Time write transactions waited to acquire the lock.", kind: "histogram", hist: func(s *hippy.Stats) hippy.Histogram {
+		return s.WriteLockWait
+	}},
+}
+
+// writeHistogram will write the samples of a histogram, Prometheus buckets are cumulative
+func writeHistogram(buf *bytes.Buffer, name, label string, hg hippy.Histogram) {
+	var count uint64
+	for i, c := range hg.Counts {
+		le := "+Inf"
+		if i < len(hg.Bounds) {
+			le = formatFloat(seconds(hg.Bounds[i]))
+		}
+
+		count += c
+		writeSample(buf, name+"_bucket", `db="`+label+`",le="`+le+`"`, float64(count))
+	}
+
+	writeSample(buf, name+"_sum", `db="`+label+`"`, seconds(hg.Sum))
+	writeSample(buf, name+"_count", `db="`+label+`"`, float64(hg.Count))
+}
+
+// writeSample will write a single sample
+func writeSample(buf *bytes.Buffer, name, labels string, v float64) {
+	buf.WriteString(name)
+	buf.WriteByte('{')
+	buf.WriteString(labels)
+	buf.WriteString("} ")
+	buf.WriteString(formatFloat(v))
+	buf.WriteByte('\n')
+}
+
+// seconds will return a duration in seconds
+func seconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Second)
+}
+
+// formatFloat will format a sample value
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// labelEscaper escapes label values as required by the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape will escape a label value
+func escape(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/itsmontoya/hippy"
+)
+
+func TestHandler(t *testing.T) {
+	var (
+		db  *hippy.Hippy
+		err error
+	)
+
+	opts, _ := hippy.NewOpts(nil)
+	opts.LogBackend = hippy.NewMemoryBackend()
+	opts.ArchiveBackend = hippy.NewMemoryBackend()
+	if db, err = hippy.New("", "metrics_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		if err = db.Write(func(txn *hippy.WriteTx) error {
+			return txn.Put("greeting", []byte("Hello!"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	if err = h.Register(`main "db"`, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = h.Register(`main "db"`, db); err != ErrIsRegistered {
+		t.Fatalf("expected %v and received %v", ErrIsRegistered, err)
+	}
+
+	if err = h.Register("", db); err != ErrInvalidName {
+		t.Fatalf("expected %v and received %v", ErrInvalidName, err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != ContentType {
+		t.Fatalf("expected content type %q and received %q", ContentType, ct)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := string(b)
+	for _, exp := range []string{
+		"# TYPE hippy_commits_total counter\n",
+		`hippy_commits_total{db="main \"db\""} 3` + "\n",
+		`hippy_keys{db="main \"db\""} 1` + "\n",
+		`hippy_value_bytes{db="main \"db\""} 6` + "\n",
+		`hippy_log_records{db="main \"db\""} 0` + "\n",
+		"# TYPE hippy_flush_duration_seconds histogram\n",
+		`hippy_flush_duration_seconds_bucket{db="main \"db\"",le="0.00005"} `,
+		`hippy_flush_duration_seconds_count{db="main \"db\""} `,
+		`hippy_compaction_duration_seconds_bucket{db="main \"db\"",le="+Inf"} 1` + "\n",
+		`hippy_compaction_duration_seconds_count{db="main \"db\""} 1` + "\n",
+		`hippy_archive_size_bytes{db="main \"db\""} 0` + "\n",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("expected output to contain %q:\n%s", exp, out)
+		}
+	}
+
+	for _, l := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		// Every sample is a labelled name followed by a value
+		i := strings.LastIndex(l, "} ")
+		if i == -1 {
+			t.Errorf("invalid sample: %q", l)
+			continue
+		}
+
+		if _, err = strconv.ParseFloat(l[i+2:], 64); err != nil {
+			t.Errorf("invalid sample value: %q", l)
+		}
+	}
+
+	h.Unregister(`main "db"`)
+	var sb strings.Builder
+	if _, err = h.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(sb.String(), "db=") {
+		t.Fatalf("expected no samples after unregistering:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,237 @@
+// Package migrate copies datasets between Hippy and other databases
+package migrate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/itsmontoya/hippy"
+)
+
+const (
+	// DefaultSeparator separates nested bucket names, and bucket names from keys when mapping to prefixes
+	DefaultSeparator = "/"
+	// DefaultRootBucket is the Bolt bucket which holds the Hippy root keyspace
+	DefaultRootBucket = "hippy"
+	// DefaultBatchSize is the number of keys written per transaction
+	DefaultBatchSize = 1000
+)
+
+// Mapping is how Bolt buckets are represented within Hippy
+type Mapping uint8
+
+const (
+	// MapPrefix maps Bolt buckets to key prefixes within the Hippy root keyspace, keys are stored as
+	// {bucket}{separator}{key}. When copying to Bolt, root keys are split at their first separator, so nested
+	// buckets are flattened into their top-level bucket
+	MapPrefix Mapping = iota
+	// MapBucket maps Bolt buckets to Hippy buckets of the same name. When copying to Bolt, bucket names containing
+	// the separator are created as nested buckets
+	MapBucket
+)
+
+// Opts are options for a migration
+type Opts struct {
+	Mapping Mapping
+	// Separator separates nested bucket names, and bucket names from keys for MapPrefix. DefaultSeparator is used when empty
+	Separator string
+	// RootBucket is the Bolt bucket which holds the Hippy root keyspace, including root keys without a separator
+	// for MapPrefix. DefaultRootBucket is used when empty
+	RootBucket string
+	// BatchSize is the number of keys written per transaction, DefaultBatchSize is used when zero
+	BatchSize int
+}
+
+// withDefaults will return options with defaults set for any empty values
+func (o Opts) withDefaults() Opts {
+	if len(o.Separator) == 0 {
+		o.Separator = DefaultSeparator
+	}
+
+	if len(o.RootBucket) == 0 {
+		o.RootBucket = DefaultRootBucket
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+
+	return o
+}
+
+// record is a key to be copied, bucket is the Hippy bucket or Bolt bucket path. The root keyspace has no bucket
+type record struct {
+	bucket string
+	key    string
+	value  []byte
+}
+
+// FromBolt will copy every bucket of a Bolt database into Hippy, the number of keys copied is returned.
+// The source is read within a single Bolt transaction, while Hippy is written in batches of Write transactions
+// Note: A migration is not atomic, dst will contain the batches which have been written when an error occurs
+func FromBolt(dst *hippy.Hippy, src *bolt.DB, opts Opts) (n int, err error) {
+	opts = opts.withDefaults()
+	batch := make([]record, 0, opts.BatchSize)
+	commit := func() (err error) {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err = dst.Write(func(txn *hippy.WriteTx) (err error) {
+			for _, r := range batch {
+				if len(r.bucket) > 0 {
+					err = txn.Bucket(r.bucket).Put(r.key, r.value)
+				} else {
+					err = txn.Put(r.key, r.value)
+				}
+
+				if err != nil {
+					return
+				}
+			}
+
+			return
+		}); err == nil {
+			n += len(batch)
+		}
+
+		batch = batch[:0]
+		return
+	}
+
+	add := func(path, k string, v []byte) (err error) {
+		// Bolt values are only valid for the life of it's transaction
+		r := record{key: k, value: append([]byte(nil), v...)}
+		switch {
+		case path == opts.RootBucket:
+		case opts.Mapping == MapBucket:
+			r.bucket = path
+		default:
+			r.key = path + opts.Separator + k
+		}
+
+		if batch = append(batch, r); len(batch) == opts.BatchSize {
+			err = commit()
+		}
+
+		return
+	}
+
+	if err = src.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return walk(b, string(name), opts.Separator, add)
+		})
+	}); err != nil {
+		return
+	}
+
+	err = commit()
+	return
+}
+
+// walk will call fn for every key within a Bolt bucket and it's nested buckets
+func walk(b *bolt.Bucket, path, sep string, fn func(path, k string, v []byte) error) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if nb := b.Bucket(k); nb != nil {
+				return walk(nb, path+sep+string(k), sep, fn)
+			}
+		}
+
+		return fn(path, string(k), v)
+	})
+}
+
+// ToBolt will copy the contents of Hippy into a Bolt database, the number of keys copied is returned. Hippy buckets
+// are copied to Bolt buckets, root keys are copied as described by the mapping.
+// Hippy is read within a single Read transaction, while Bolt is written in batches of Update transactions
+// Note: Writes to src are blocked until the copy completes. A migration is not atomic, dst will contain the batches
+// which have been written when an error occurs
+func ToBolt(dst *bolt.DB, src *hippy.Hippy, opts Opts) (n int, err error) {
+	opts = opts.withDefaults()
+	batch := make([]record, 0, opts.BatchSize)
+	commit := func() (err error) {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err = dst.Update(func(tx *bolt.Tx) (err error) {
+			for _, r := range batch {
+				var b *bolt.Bucket
+				if b, err = createBucket(tx, strings.Split(r.bucket, opts.Separator)); err != nil {
+					return
+				}
+
+				if err = b.Put([]byte(r.key), r.value); err != nil {
+					return
+				}
+			}
+
+			return
+		}); err == nil {
+			n += len(batch)
+		}
+
+		batch = batch[:0]
+		return
+	}
+
+	add := func(r record) (err error) {
+		if batch = append(batch, r); len(batch) == opts.BatchSize {
+			err = commit()
+		}
+
+		return
+	}
+
+	if err = src.Read(func(txn *hippy.ReadTx) (err error) {
+		keys := txn.Keys()
+		sort.Strings(keys)
+		for _, k := range keys {
+			v, _ := txn.Get(k)
+			r := record{bucket: opts.RootBucket, key: k, value: v}
+			if opts.Mapping == MapPrefix {
+				if i := strings.Index(k, opts.Separator); i > 0 && i+len(opts.Separator) < len(k) {
+					r.bucket, r.key = k[:i], k[i+len(opts.Separator):]
+				}
+			}
+
+			if err = add(r); err != nil {
+				return
+			}
+		}
+
+		names := txn.Buckets()
+		sort.Strings(names)
+		for _, name := range names {
+			if err = txn.Bucket(name).ForEach(func(k string, v []byte) error {
+				return add(record{bucket: name, key: k, value: v})
+			}); err != nil {
+				return
+			}
+		}
+
+		return
+	}); err != nil {
+		return
+	}
+
+	err = commit()
+	return
+}
+
+// createBucket will return the bucket at the provided path, creating any buckets which do not exist
+func createBucket(tx *bolt.Tx, path []string) (b *bolt.Bucket, err error) {
+	if b, err = tx.CreateBucketIfNotExists([]byte(path[0])); err != nil {
+		return
+	}
+
+	for _, name := range path[1:] {
+		if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return
+		}
+	}
+
+	return
+}
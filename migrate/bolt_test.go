@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/itsmontoya/hippy"
+)
+
+func TestBolt(t *testing.T) {
+	var (
+		src, dst *bolt.DB
+		db       *hippy.Hippy
+		n        int
+		dir      string
+		err      error
+	)
+
+	if dir, err = ioutil.TempDir("", "migrate_test"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if src, err = bolt.Open(filepath.Join(dir, "src.bdb"), 0644, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	if err = src.Update(func(tx *bolt.Tx) (err error) {
+		users, _ := tx.CreateBucket([]byte("users"))
+		users.Put([]byte("1"), []byte("Hippy"))
+		users.Put([]byte("2"), []byte("Potamus"))
+
+		admins, _ := users.CreateBucket([]byte("admins"))
+		admins.Put([]byte("1"), []byte("yes"))
+
+		root, _ := tx.CreateBucket([]byte(DefaultRootBucket))
+		return root.Put([]byte("greeting"), []byte("Hello!"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := boltContents(t, src)
+
+	hOpts, _ := hippy.NewOpts(nil)
+	hOpts.InMemory = true
+
+	tests := []struct {
+		mapping Mapping
+		hippy   map[string]string // Expected Hippy contents, bucket keys are formatted as bucket:key
+		bolt    map[string]string // Expected Bolt contents after copying back, keys are formatted as path:key
+	}{
+		{
+			mapping: MapBucket,
+			hippy: map[string]string{
+				"greeting":       "Hello!",
+				"users:1":        "Hippy",
+				"users:2":        "Potamus",
+				"users/admins:1": "yes",
+			},
+			bolt: exp,
+		},
+		{
+			mapping: MapPrefix,
+			hippy: map[string]string{
+				"greeting":       "Hello!",
+				"users/1":        "Hippy",
+				"users/2":        "Potamus",
+				"users/admins/1": "yes",
+			},
+			// Nested buckets are flattened into their top-level bucket
+			bolt: map[string]string{
+				"hippy:greeting": "Hello!",
+				"users:1":        "Hippy",
+				"users:2":        "Potamus",
+				"users:admins/1": "yes",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		opts := Opts{Mapping: tt.mapping, BatchSize: 2}
+		if db, err = hippy.New("", "migrate_test", hOpts); err != nil {
+			t.Fatal("Error opening:", err)
+		}
+
+		if n, err = FromBolt(db, src, opts); err != nil || n != 4 {
+			t.Fatalf("mapping %d: expected 4 keys and received %d (%v)", tt.mapping, n, err)
+		}
+
+		if got := hippyContents(t, db); !reflect.DeepEqual(got, tt.hippy) {
+			t.Errorf("mapping %d: invalid Hippy contents: %v", tt.mapping, got)
+		}
+
+		path := filepath.Join(dir, "dst.bdb")
+		os.Remove(path)
+		if dst, err = bolt.Open(path, 0644, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err = ToBolt(dst, db, opts); err != nil || n != 4 {
+			t.Fatalf("mapping %d: expected 4 keys and received %d (%v)", tt.mapping, n, err)
+		}
+
+		if got := boltContents(t, dst); !reflect.DeepEqual(got, tt.bolt) {
+			t.Errorf("mapping %d: invalid Bolt contents: %v", tt.mapping, got)
+		}
+
+		dst.Close()
+		db.Close()
+	}
+}
+
+// hippyContents will return the contents of a Hippy database, bucket keys are formatted as bucket:key
+func hippyContents(t *testing.T, db *hippy.Hippy) (m map[string]string) {
+	m = make(map[string]string)
+	db.Read(func(txn *hippy.ReadTx) error {
+		for _, k := range txn.Keys() {
+			v, _ := txn.Get(k)
+			m[k] = string(v)
+		}
+
+		for _, name := range txn.Buckets() {
+			txn.Bucket(name).ForEach(func(k string, v []byte) error {
+				m[name+":"+k] = string(v)
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// boltContents will return the contents of a Bolt database, keys are formatted as path:key
+func boltContents(t *testing.T, db *bolt.DB) (m map[string]string) {
+	m = make(map[string]string)
+	if err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return walk(b, string(name), DefaultSeparator, func(path, k string, v []byte) error {
+				m[path+":"+k] = string(v)
+				return nil
+			})
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
@@ -1,6 +1,8 @@
 package hippy
 
 import (
+	"time"
+
 	"github.com/go-ini/ini"
 )
 
@@ -14,8 +16,20 @@ var defaultOptions = Opts{
 	CompactOnClose: true,
 
 	AsyncBackend: false,
+	ReadOnly:     false,
+	InMemory:     false,
+
+	ReapInterval: time.Minute,
+
+	SequenceLease: defaultSequenceLease,
+
+	WatchBuffer: defaultWatchBuffer,
+	WatchPolicy: WatchClose,
 }
 
+// defaultSequenceLease is the default number of IDs leased by a sequence at a time
+const defaultSequenceLease = 1000
+
 // NewOpts returns new options for Hippy
 func NewOpts(src interface{}) (o Opts, err error) {
 	if src == nil {
@@ -39,4 +53,45 @@ type Opts struct {
 	CompactOnClose bool `ini:"compactOnClose"`
 
 	AsyncBackend bool `ini:"asyncBackend"`
+
+	// ReadOnly will open the database without writing, Write and ReadWrite will return ErrReadOnly
+	// Note: Archiving and compaction do not occur on Close. A read-only instance may still Follow a leader
+	ReadOnly bool `ini:"readOnly"`
+
+	// InMemory will open the database without any backing files, data only persists when explicitly saved with SaveTo
+	// Note: The path and name provided to New are ignored. Changes are not available to ChangesSince or replication
+	InMemory bool `ini:"inMemory"`
+
+	// LogBackend is the backend used for the log, a file backend within the database path is used when nil.
+	// Note: The inter-process lock is not acquired when a log backend is provided
+	LogBackend Backend `ini:"-"`
+	// ArchiveBackend is the backend used for the archive, a file backend within the database path is used when nil
+	ArchiveBackend Backend `ini:"-"`
+
+	// LockTimeout is how long New will wait for another process to release the database, New will not wait when zero
+	LockTimeout time.Duration `ini:"lockTimeout"`
+
+	// ReapInterval is the interval at which expired keys are deleted, the reaper is disabled when zero
+	ReapInterval time.Duration `ini:"reapInterval"`
+
+	// SequenceLease is the number of IDs a sequence will lease from the log at a time
+	SequenceLease uint64 `ini:"sequenceLease"`
+
+	// Indexes are the secondary index extractors by index name, indexes cover the root keyspace
+	Indexes map[string]IndexFunc `ini:"-"`
+
+	// WatchBuffer is the number of events buffered for each watcher
+	WatchBuffer int `ini:"watchBuffer"`
+	// WatchPolicy is the policy used when a watcher's buffer is full
+	WatchPolicy WatchPolicy `ini:"watchPolicy"`
+
+	// PreCommit hooks are able to inspect and reject transactions before they are written
+	PreCommit []PreCommitFunc `ini:"-"`
+	// PostCommit hooks receive the changes of transactions after they are flushed
+	PostCommit []PostCommitFunc `ini:"-"`
+
+	// Logger receives diagnostic messages, such as replay, archive, and compaction failures. Messages are discarded when nil
+	Logger Logger `ini:"-"`
+	// Trace funcs receive the outcome of transactions, flushes, archives, and compactions, see TraceOp
+	Trace []TraceFunc `ini:"-"`
 }
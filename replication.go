@@ -0,0 +1,439 @@
+package hippy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// ErrDiverged is returned when a follower's log does not share history with it's leader
+	ErrDiverged = errors.Error("follower log has diverged from leader")
+
+	// ErrFrameTooLarge is returned when a replication frame exceeds the maximum frame size
+	ErrFrameTooLarge = errors.Error("replication frame is too large")
+)
+
+// maxFrameLen is the maximum length of a replication frame
+const maxFrameLen = 64 * 1024 * 1024
+
+// ServeFollower will stream committed log records to a follower over the provided connection. Records which the follower
+// has not yet applied are read from the archive and log, after which new commits are streamed as they are flushed.
+// ServeFollower returns when the connection is closed, the database is closed, or an error occurs. ErrLSNUnavailable is
+// returned when commits the follower has not applied are compacted without being archived
+// Note: The leader and follower must be opened with the same middlewares. In-memory instances cannot be replicated
+func (h *Hippy) ServeFollower(conn net.Conn) (err error) {
+	var (
+		lsn  uint64
+		hash string
+		cs   []Commit
+	)
+
+	if h.opts.InMemory {
+		// We do not have a log to stream to our follower
+		return ErrInMemory
+	}
+
+	if lsn, hash, err = readHandshake(conn); err != nil {
+		return
+	}
+
+	h.mux.Lock()
+	if h.closed {
+		err = ErrIsClosed
+	} else {
+		err = h.verifyFollower(lsn, hash)
+	}
+	h.mux.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	// The follower will not send anything further, a read returning signals that the connection has closed
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(gone)
+	}()
+
+	w := bufio.NewWriter(conn)
+SEEK:
+	for _, tgt := range []Backend{h.af, h.f} {
+		var (
+			line int             // Line index to continue reading from
+			gen  int             // Log generation our line index belongs to
+			done bool            // End of file reached
+			seek bool            // Our log was replaced since our last read
+			next <-chan struct{} // Closed on our next commit
+		)
+
+		for {
+			h.mux.Lock()
+			switch {
+			case h.closed:
+				err = ErrIsClosed
+			case line > 0 && gen != h.gen:
+				seek = true
+			default:
+				gen = h.gen
+				cs, line, done, err = h.readCommits(tgt, line, lsn, true)
+				next = h.cc
+			}
+			h.mux.Unlock()
+
+			if err != nil {
+				return
+			}
+
+			if seek {
+				// Our line index is stale, seek to our follower's log sequence number from the start of our archive.
+				// Commits which were compacted without being archived will return ErrLSNUnavailable
+				goto SEEK
+			}
+
+			for _, c := range cs {
+				for _, l := range c.lines {
+					if err = writeFrame(w, l); err != nil {
+						return
+					}
+				}
+
+				lsn = c.LSN
+			}
+
+			if err = w.Flush(); err != nil {
+				return
+			}
+
+			if !done {
+				continue
+			}
+
+			if tgt == h.af {
+				// Our archive has been read, move on to our log
+				break
+			}
+
+			// We have caught up, wait for our next commit
+			select {
+			case <-next:
+			case <-gone:
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// verifyFollower will ensure a follower shares history with our log
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) verifyFollower(lsn uint64, hash string) (err error) {
+	if lsn == 0 {
+		// Follower has not applied any commits, it will receive our full history
+		return
+	}
+
+	if lsn > h.seq {
+		return ErrDiverged
+	}
+
+	if len(hash) == 0 {
+		return
+	}
+
+	if _, err = h.findHash(h.f, hash); err != ErrHashNotFound {
+		return
+	}
+
+	if _, err = h.findHash(h.af, hash); err == ErrHashNotFound {
+		err = ErrDiverged
+	}
+
+	return
+}
+
+// Follow will apply the committed log records streamed by a leader's ServeFollower. The database becomes read-only
+// for the remainder of it's life, records are written to our own log and applied to memory as each commit is received.
+// Follow returns when the connection is closed, the database is closed, or an error occurs
+// Note: The leader and follower must be opened with the same middlewares. In-memory instances cannot follow a leader.
+// The inter-process lock is acquired before anything is written, ErrLocked is returned if it is held by another process
+func (h *Hippy) Follow(conn net.Conn) (err error) {
+	var (
+		lsn  uint64
+		hash string
+		b    []byte
+	)
+
+	if h.opts.InMemory {
+		// We do not have a log to write our leader's records to
+		return ErrInMemory
+	}
+
+	h.mux.Lock()
+	switch {
+	case h.closed:
+		err = ErrIsClosed
+	case h.lk == nil && h.opts.LogBackend == nil:
+		// We are about to write to our log, exclude writers and other followers as a writable instance would
+		h.lk, err = newFileLock(h.path, h.name, h.opts.LockTimeout)
+	}
+
+	if err == nil {
+		h.ro = true
+		lsn = h.seq
+		if _, hash, err = h.getLastHash(h.f); err == ErrHashNotFound {
+			err = nil
+		}
+	}
+	h.mux.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	if err = writeHandshake(conn, lsn, hash); err != nil {
+		return
+	}
+
+	var (
+		r  = bufio.NewReader(conn)
+		ls [][]byte // Raw lines for the current transaction
+		rs []record // Records for the current transaction
+	)
+
+	for {
+		if b, err = readFrame(r, b); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+
+			return
+		}
+
+		if ls, rs, err = h.follow(b, ls, rs); err != nil {
+			return
+		}
+	}
+}
+
+// follow will process a line received from a leader. Lines are buffered until a commit is received, at which point they are
+// written to our log and applied to memory
+func (h *Hippy) follow(b []byte, ls [][]byte, rs []record) ([][]byte, []record, error) {
+	var (
+		key string
+		act action
+		lsn int64
+		err error
+	)
+
+	line := append([]byte(nil), b...)
+	if key, act, err = h.parseLogLine(bytes.NewBuffer(b)); err != nil {
+		return ls, rs, err
+	}
+
+	ls = append(ls, line)
+	switch act.a {
+	case _put, _del, _bput, _bdel, _bdrop:
+		rs = append(rs, record{key: key, act: act})
+		return ls, rs, nil
+	case _commit, _checkpoint:
+		if lsn, err = DecodeInt64(act.b); err != nil {
+			return ls, rs, err
+		}
+	case _lease:
+		if len(rs) > 0 {
+			// Leases within a compacted snapshot are applied with it's checkpoint
+			return ls, rs, nil
+		}
+
+		err = h.followLease(ls, key, act)
+		return ls[:0], rs, err
+	default:
+		return ls, rs, nil
+	}
+
+	h.mux.Lock()
+	if h.closed {
+		err = ErrIsClosed
+		goto END
+	}
+
+	if err = h.rollback(); err != nil {
+		goto END
+	}
+
+	for _, l := range ls {
+		// We are going to write before modifying memory
+		if err = h.writeLine(l); err != nil {
+			goto END
+		}
+	}
+
+	if err = h.flush(); err != nil {
+		goto END
+	}
+
+	for _, l := range ls {
+		// Apply any leases which accompanied the commit
+		if l[0] != _lease {
+			continue
+		}
+
+		if key, act, err = h.parseLogLine(bytes.NewBuffer(append([]byte(nil), l...))); err != nil {
+			goto END
+		}
+
+		if err = h.applyLease(key, act.b); err != nil {
+			goto END
+		}
+	}
+
+	if err = h.applyRecords(rs); err != nil {
+		goto END
+	}
+
+	if act.a == _checkpoint {
+		h.st.records = 0
+	} else {
+		h.st.records += len(rs)
+	}
+
+	h.commit(uint64(lsn))
+	h.st.commits++
+	for _, r := range rs {
+		// Notify watchers of our replicated changes, records have already been validated by applyRecords
+		e, _ := newRecordEvent(r.key, r.act)
+		e.Seq = uint64(lsn)
+		h.w.notifyEvent(e)
+	}
+
+END:
+	h.mux.Unlock()
+	return ls[:0], rs[:0], err
+}
+
+// followLease will write a lease received outside of a transaction to our log and apply it, along with any lines which
+// preceded it. Leases which do not raise our leased upper bound were re-sent by our leader and are not written
+func (h *Hippy) followLease(ls [][]byte, name string, act action) (err error) {
+	var upper int64
+	if upper, err = DecodeInt64(act.b); err != nil {
+		return
+	}
+
+	h.mux.Lock()
+	if h.closed {
+		err = ErrIsClosed
+		goto END
+	}
+
+	if uint64(upper) <= h.seqs[name] {
+		// Our lease is already at or beyond this lease, only the lines which preceded it are written
+		ls = ls[:len(ls)-1]
+	}
+
+	if len(ls) == 0 {
+		goto END
+	}
+
+	if err = h.rollback(); err != nil {
+		goto END
+	}
+
+	for _, l := range ls {
+		// We are going to write before modifying memory
+		if err = h.writeLine(l); err != nil {
+			goto END
+		}
+	}
+
+	if err = h.flush(); err != nil {
+		goto END
+	}
+
+	if uint64(upper) > h.seqs[name] {
+		h.seqs[name] = uint64(upper)
+	}
+
+END:
+	h.mux.Unlock()
+	return
+}
+
+// writeHandshake will write a follower handshake containing it's log sequence number and last hash
+func writeHandshake(w io.Writer, lsn uint64, hash string) (err error) {
+	b := make([]byte, 0, intLen+1+len(hash))
+	b = append(b, EncodeInt64(int64(lsn))...)
+	b = append(b, uint8(len(hash)))
+	b = append(b, hash...)
+	_, err = w.Write(b)
+	return
+}
+
+// readHandshake will read a follower handshake
+func readHandshake(r io.Reader) (lsn uint64, hash string, err error) {
+	var (
+		b [intLen + 1]byte
+		n int64
+	)
+
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return
+	}
+
+	if n, err = DecodeInt64(b[:intLen]); err != nil {
+		return
+	}
+
+	hb := make([]byte, b[intLen])
+	if _, err = io.ReadFull(r, hb); err != nil {
+		return
+	}
+
+	lsn = uint64(n)
+	hash = string(hb)
+	return
+}
+
+// writeFrame will write a length-prefixed frame
+func writeFrame(w io.Writer, b []byte) (err error) {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+	if _, err = w.Write(l[:]); err != nil {
+		return
+	}
+
+	_, err = w.Write(b)
+	return
+}
+
+// readFrame will read a length-prefixed frame, re-using the provided buffer when possible
+func readFrame(r io.Reader, buf []byte) (b []byte, err error) {
+	var l [4]byte
+	if _, err = io.ReadFull(r, l[:]); err != nil {
+		return
+	}
+
+	n := binary.BigEndian.Uint32(l[:])
+	if n > maxFrameLen {
+		err = ErrFrameTooLarge
+		return
+	}
+
+	if cap(buf) < int(n) {
+		buf = make([]byte, n)
+	}
+
+	b = buf[:n]
+	if _, err = io.ReadFull(r, b); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return
+}
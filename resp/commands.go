@@ -0,0 +1,633 @@
+package resp
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	errSyntax           = errors.Error("syntax error")
+	errNotInteger       = errors.Error("value is not an integer or out of range")
+	errOverflow         = errors.Error("increment or decrement would overflow")
+	errBinaryInteger    = errors.Error("value is a binary integer written by ReadWriteTx.Incr, INCR requires a decimal string")
+	errInvalidCursor    = errors.Error("invalid cursor")
+	errNestedMulti      = errors.Error("MULTI calls can not be nested")
+	errExecWithoutMulti = errors.Error("EXEC without MULTI")
+	errDiscardNoMulti   = errors.Error("DISCARD without MULTI")
+
+	errExecAbort = codeError("EXECABORT Transaction discarded because of previous errors.")
+)
+
+// defaultScanCount is the number of keys a SCAN will iterate over when COUNT is not provided
+const defaultScanCount = 10
+
+// commands are the supported commands, keyed by their upper case name. MULTI, EXEC and DISCARD are handled by the session
+var commands = map[string]*command{
+	"PING":    {arity: -1, local: ping},
+	"ECHO":    {arity: 2, local: echo},
+	"COMMAND": {arity: -1, local: commandInfo},
+
+	"GET":    {arity: 2, read: get},
+	"EXISTS": {arity: -2, read: exists},
+	"KEYS":   {arity: 2, read: keys},
+	"SCAN":   {arity: -2, read: scan},
+
+	"SET":    {arity: -3, write: set},
+	"DEL":    {arity: -2, write: del},
+	"INCR":   {arity: 2, write: incr},
+	"EXPIRE": {arity: 3, write: expire},
+}
+
+// store is the read-only view of a transaction used by read commands
+type store interface {
+	Get(k string) ([]byte, bool)
+	Keys() []string
+}
+
+// command is a supported command, exactly one of local, read or write is set
+type command struct {
+	// Number of arguments including the command name, negative values are a minimum
+	arity int
+
+	// Commands which do not access the database
+	local func(args [][]byte) interface{}
+	// Commands which only read from the database
+	read func(s store, args [][]byte) interface{}
+	// Commands which modify the database
+	write func(txn *hippy.ReadWriteTx, args [][]byte) interface{}
+}
+
+// isValid will return whether or not the number of arguments matches the command's arity
+func (c *command) isValid(n int) bool {
+	if c.arity < 0 {
+		return n >= -c.arity
+	}
+
+	return n == c.arity
+}
+
+// call will execute a command. Write commands require txn, read commands use txn when it is set and s otherwise
+// Note: Commands report failures as error replies. They validate their arguments before modifying txn,
+// so an error reply never leaves a partial change behind
+func (c *command) call(s store, txn *hippy.ReadWriteTx, args [][]byte) interface{} {
+	switch {
+	case c.local != nil:
+		return c.local(args)
+	case c.write != nil:
+		return c.write(txn, args)
+	case txn != nil:
+		return c.read(txn, args)
+	default:
+		return c.read(s, args)
+	}
+}
+
+// queued is a command which has been queued within a MULTI block
+type queued struct {
+	cmd  *command
+	args [][]byte
+}
+
+// session is the state of a single connection
+type session struct {
+	db *hippy.Hippy
+
+	multi   bool     // Within a MULTI block
+	aborted bool     // A command within the MULTI block was rejected, EXEC will fail
+	queue   []queued // Commands queued within the MULTI block
+}
+
+// exec will execute a command and return it's reply
+func (c *session) exec(args [][]byte) interface{} {
+	name := strings.ToUpper(string(args[0]))
+	switch name {
+	case "MULTI":
+		if c.multi {
+			return errNestedMulti
+		}
+
+		c.multi = true
+		return simple("OK")
+
+	case "EXEC":
+		if !c.multi {
+			return errExecWithoutMulti
+		}
+
+		return c.commit()
+
+	case "DISCARD":
+		if !c.multi {
+			return errDiscardNoMulti
+		}
+
+		c.reset()
+		return simple("OK")
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		// Rejected commands cause the MULTI block to be discarded on EXEC
+		c.aborted = c.multi
+		return errors.Error("unknown command '" + string(args[0]) + "'")
+	}
+
+	if !cmd.isValid(len(args)) {
+		c.aborted = c.multi
+		return errors.Error("wrong number of arguments for '" + strings.ToLower(name) + "' command")
+	}
+
+	if c.multi {
+		c.queue = append(c.queue, queued{cmd: cmd, args: args})
+		return simple("QUEUED")
+	}
+
+	return c.run([]queued{{cmd: cmd, args: args}}, false)
+}
+
+// commit will execute the commands within the MULTI block as a single transaction and end the block
+func (c *session) commit() interface{} {
+	q := c.queue
+	aborted := c.aborted
+	c.reset()
+
+	if aborted {
+		return errExecAbort
+	}
+
+	return c.run(q, true)
+}
+
+// run will execute commands within a single transaction, an array of their replies is returned when asArray is true.
+// Commands without writes are executed as a read transaction, allowing read-only databases to be served
+// Note: Like Redis, a command which fails does not prevent the remaining commands from being executed
+func (c *session) run(q []queued, asArray bool) interface{} {
+	var err error
+	rs := make(array, len(q))
+	if isReadOnly(q) {
+		err = c.db.Read(func(txn *hippy.ReadTx) error {
+			for i, qc := range q {
+				rs[i] = qc.cmd.call(txn, nil, qc.args)
+			}
+
+			return nil
+		})
+	} else {
+		err = c.db.ReadWrite(func(txn *hippy.ReadWriteTx) error {
+			for i, qc := range q {
+				rs[i] = qc.cmd.call(nil, txn, qc.args)
+			}
+
+			return nil
+		})
+	}
+
+	switch {
+	case err != nil:
+		return err
+	case asArray:
+		return rs
+	default:
+		return rs[0]
+	}
+}
+
+// reset will end the current MULTI block
+func (c *session) reset() {
+	c.multi = false
+	c.aborted = false
+	c.queue = nil
+}
+
+// isReadOnly will return whether or not a set of commands contains no writes
+func isReadOnly(q []queued) bool {
+	for _, qc := range q {
+		if qc.cmd.write != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isCommand will return whether or not args are a call of the provided upper case command name
+func isCommand(args [][]byte, name string) bool {
+	return strings.ToUpper(string(args[0])) == name
+}
+
+// ping will reply with PONG, or the provided message
+func ping(args [][]byte) interface{} {
+	switch len(args) {
+	case 1:
+		return simple("PONG")
+	case 2:
+		return bulk(args[1])
+	default:
+		return errors.Error("wrong number of arguments for 'ping' command")
+	}
+}
+
+// echo will reply with the provided message
+func echo(args [][]byte) interface{} {
+	return bulk(args[1])
+}
+
+// commandInfo will reply with an empty array, clients such as redis-cli use COMMAND for hints only
+func commandInfo(args [][]byte) interface{} {
+	return array{}
+}
+
+// get will reply with the value of a key, or null if it does not exist
+func get(s store, args [][]byte) interface{} {
+	if v, ok := s.Get(string(args[1])); ok {
+		return bulk(v)
+	}
+
+	return null{}
+}
+
+// exists will reply with the number of provided keys which exist, keys provided multiple times are counted multiple times
+func exists(s store, args [][]byte) interface{} {
+	var n int64
+	for _, k := range args[1:] {
+		if _, ok := s.Get(string(k)); ok {
+			n++
+		}
+	}
+
+	return n
+}
+
+// keys will reply with the keys matching a glob-style pattern, in key order
+func keys(s store, args [][]byte) interface{} {
+	pattern := string(args[1])
+	rs := array{}
+	for _, k := range sortedKeys(s) {
+		if match(pattern, k) {
+			rs = append(rs, bulk(k))
+		}
+	}
+
+	return rs
+}
+
+// scan will reply with the next cursor and a page of keys. SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+// Note: The cursor is an offset into the sorted keys of the database. As with Redis, keys which are added or removed
+// during a scan may or may not be returned
+func scan(s store, args [][]byte) interface{} {
+	var (
+		cursor  uint64
+		count   = defaultScanCount
+		pattern = "*"
+		typ     = "string"
+		err     error
+	)
+
+	if cursor, err = strconv.ParseUint(string(args[1]), 10, 64); err != nil {
+		return errInvalidCursor
+	}
+
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errSyntax
+		}
+
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil {
+				return errNotInteger
+			}
+
+			if count < 1 {
+				return errSyntax
+			}
+		case "TYPE":
+			typ = strings.ToLower(string(args[i+1]))
+		default:
+			return errSyntax
+		}
+	}
+
+	ks := sortedKeys(s)
+	start, end := len(ks), len(ks)
+	if cursor < uint64(len(ks)) {
+		start = int(cursor)
+	}
+
+	if count < end-start {
+		end = start + count
+	}
+
+	page := array{}
+	// All values are strings, scanning for any other type returns no keys
+	for _, k := range ks[start:end] {
+		if typ == "string" && match(pattern, k) {
+			page = append(page, bulk(k))
+		}
+	}
+
+	next := "0"
+	if end < len(ks) {
+		next = strconv.Itoa(end)
+	}
+
+	return array{bulk(next), page}
+}
+
+// set will set the value of a key. SET key value [EX seconds | PX milliseconds | KEEPTTL] [NX | XX]
+func set(txn *hippy.ReadWriteTx, args [][]byte) interface{} {
+	var (
+		k = string(args[1])
+		v = args[2]
+
+		ttl     time.Duration
+		keepTTL bool
+		nx, xx  bool
+		err     error
+	)
+
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i++; i == len(args) || ttl != 0 {
+				return errSyntax
+			}
+
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+
+			if ttl, err = parseTTL(args[i], unit); err != nil {
+				return errors.Error("invalid expire time in 'set' command")
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	if (nx && xx) || (keepTTL && ttl != 0) {
+		return errSyntax
+	}
+
+	if nx || xx {
+		if _, ok := txn.Get(k); ok == nx {
+			// Condition has not been met, reply with null
+			return null{}
+		}
+	}
+
+	switch {
+	case ttl != 0:
+		err = txn.PutWithTTL(k, v, ttl)
+	case keepTTL:
+		err = putKeepTTL(txn, k, v)
+	default:
+		err = txn.Put(k, v)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return simple("OK")
+}
+
+// del will delete keys and reply with the number of keys which existed
+func del(txn *hippy.ReadWriteTx, args [][]byte) interface{} {
+	var n int64
+	for _, k := range args[1:] {
+		if _, ok := txn.Get(string(k)); !ok {
+			continue
+		}
+
+		txn.Del(string(k))
+		n++
+	}
+
+	return n
+}
+
+// incr will increment the integer stored at a key and reply with the new value. Missing keys are treated as zero
+// Note: Values are stored as decimal strings for compatibility with Redis clients, the key's expiry is retained. This
+// differs from ReadWriteTx.Incr, which stores EncodeInt64 values. Binary values are rejected rather than misread
+func incr(txn *hippy.ReadWriteTx, args [][]byte) interface{} {
+	var (
+		k = string(args[1])
+		n int64
+	)
+
+	if v, ok := txn.Get(k); ok {
+		var err error
+		if n, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+			if isBinaryInteger(v) {
+				return errBinaryInteger
+			}
+
+			return errNotInteger
+		}
+	}
+
+	if n == math.MaxInt64 {
+		return errOverflow
+	}
+
+	n++
+	if err := putKeepTTL(txn, k, []byte(strconv.FormatInt(n, 10))); err != nil {
+		return err
+	}
+
+	return n
+}
+
+// expire will set the expiry of a key and reply with 1, or 0 if the key does not exist.
+// A non-positive expiry deletes the key
+func expire(txn *hippy.ReadWriteTx, args [][]byte) interface{} {
+	var (
+		k   = string(args[1])
+		ttl time.Duration
+		err error
+	)
+
+	secs, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+
+	if secs > 0 {
+		if ttl, err = parseTTL(args[2], time.Second); err != nil {
+			return errors.Error("invalid expire time in 'expire' command")
+		}
+	}
+
+	v, ok := txn.Get(k)
+	if !ok {
+		return int64(0)
+	}
+
+	if ttl == 0 {
+		txn.Del(k)
+		return int64(1)
+	}
+
+	if err = txn.PutWithTTL(k, v, ttl); err != nil {
+		return err
+	}
+
+	return int64(1)
+}
+
+// isBinaryInteger will return whether or not a value which is not a decimal string is an EncodeInt64 value
+func isBinaryInteger(v []byte) bool {
+	_, err := hippy.DecodeInt64(v)
+	return err == nil
+}
+
+// putKeepTTL will put a value while retaining the key's current expiry
+func putKeepTTL(txn *hippy.ReadWriteTx, k string, v []byte) (err error) {
+	if exp, ok := txn.Expiry(k); ok {
+		if ttl := time.Until(exp); ttl > 0 {
+			return txn.PutWithTTL(k, v, ttl)
+		}
+	}
+
+	return txn.Put(k, v)
+}
+
+// parseTTL will parse a positive integer of the provided unit as a duration
+func parseTTL(b []byte, unit time.Duration) (ttl time.Duration, err error) {
+	var n int64
+	if n, err = strconv.ParseInt(string(b), 10, 64); err != nil {
+		return
+	}
+
+	if n <= 0 || n > int64(math.MaxInt64/unit) {
+		err = errSyntax
+		return
+	}
+
+	ttl = time.Duration(n) * unit
+	return
+}
+
+// sortedKeys will return the keys of a store in key order
+func sortedKeys(s store) (ks []string) {
+	ks = s.Keys()
+	sort.Strings(ks)
+	return
+}
+
+// match will return whether or not a key matches a glob-style pattern, as supported by KEYS and SCAN.
+// Supported are *, ?, character classes such as [abc], [^abc] and [a-z], and escaping with \
+// Note: Only the last star is retried when a match fails, matching takes at most O(len(pattern) * len(k))
+func match(pattern, k string) bool {
+	var (
+		p, i  int  // Pattern and key indexes
+		star  = -1 // Pattern index following our last star, -1 until a star has been seen
+		retry int  // Key index our last star resumes matching from
+	)
+
+	for i < len(k) {
+		if p < len(pattern) && pattern[p] == '*' {
+			// Consecutive stars are equivalent to a single star
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+
+			star, retry = p, i
+			continue
+		}
+
+		if p < len(pattern) {
+			if n, ok := matchChar(pattern[p:], k[i]); ok {
+				p += n
+				i++
+				continue
+			}
+		}
+
+		if star == -1 {
+			return false
+		}
+
+		// Our last star consumes one more character, and we resume matching from the pattern which follows it
+		retry++
+		p, i = star, retry
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchChar will match a character against the pattern token at the start of the pattern, which is not a star.
+// The number of pattern bytes consumed by the token is returned
+func matchChar(pattern string, c byte) (n int, ok bool) {
+	switch {
+	case pattern[0] == '?':
+		return 1, true
+
+	case pattern[0] == '[':
+		var rest string
+		ok, rest = matchClass(pattern[1:], c)
+		return len(pattern) - len(rest), ok
+
+	case pattern[0] == '\\' && len(pattern) > 1:
+		return 2, pattern[1] == c
+	}
+
+	return 1, pattern[0] == c
+}
+
+// matchClass will match a character against a character class, pattern begins after the opening bracket.
+// The remainder of the pattern following the class is returned
+func matchClass(pattern string, c byte) (ok bool, rest string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			ok = ok || pattern[1] == c
+			pattern = pattern[2:]
+
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+
+			ok = ok || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+
+		default:
+			ok = ok || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+
+	if len(pattern) > 0 {
+		// Skip the closing bracket
+		pattern = pattern[1:]
+	}
+
+	return ok != negate, pattern
+}
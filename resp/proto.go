@@ -0,0 +1,219 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// MaxArgs is the maximum number of arguments a command may contain
+	MaxArgs = 1024 * 1024
+	// MaxBulkLen is the maximum length of a bulk string argument
+	MaxBulkLen = 64 * 1024 * 1024
+	// maxLineLen is the maximum length of a line, such as an inline command or a length header
+	maxLineLen = 64 * 1024
+	// maxPrealloc is the maximum number of arguments, or bytes of a bulk string, allocated ahead of being read.
+	// Larger requests grow as their data arrives, so that a length header alone cannot force a large allocation
+	maxPrealloc = 64 * 1024
+)
+
+const (
+	// ErrProtocol is returned when a request does not conform to the RESP protocol
+	ErrProtocol = errors.Error("protocol error")
+	// ErrTooLarge is returned when a request exceeds MaxArgs or MaxBulkLen
+	ErrTooLarge = errors.Error("request too large")
+)
+
+var crlf = []byte("\r\n")
+
+// Reply types, see writeReply
+type (
+	// simple is a simple string reply
+	simple string
+	// bulk is a bulk string reply
+	bulk []byte
+	// null is a null bulk string reply
+	null struct{}
+	// array is an array reply
+	array []interface{}
+)
+
+// readCommand will read a command from r. Commands are either an array of bulk strings, or an inline command
+// consisting of space separated arguments. An empty inline command returns no arguments
+func readCommand(r *bufio.Reader) (args [][]byte, err error) {
+	var (
+		line []byte
+		n    int
+	)
+
+	if line, err = readLine(r); err != nil {
+		return
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		// Inline command
+		return bytes.Fields(line), nil
+	}
+
+	if n, err = parseLen(line[1:], MaxArgs); err != nil {
+		return
+	}
+
+	c := n
+	if c > maxPrealloc {
+		c = maxPrealloc
+	}
+
+	args = make([][]byte, 0, c)
+	for i := 0; i < n; i++ {
+		if line, err = readLine(r); err != nil {
+			return
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			err = ErrProtocol
+			return
+		}
+
+		var l int
+		if l, err = parseLen(line[1:], MaxBulkLen); err != nil {
+			return
+		}
+
+		var b []byte
+		if b, err = readBulk(r, l); err != nil {
+			return
+		}
+
+		args = append(args, b)
+	}
+
+	return
+}
+
+// readBulk will read a bulk string of the provided length and it's trailing CRLF
+func readBulk(r *bufio.Reader, l int) (b []byte, err error) {
+	if l+2 <= maxPrealloc {
+		b = make([]byte, l+2)
+		_, err = io.ReadFull(r, b)
+	} else {
+		// Grow as our data arrives rather than trusting the length header
+		buf := bytes.NewBuffer(make([]byte, 0, maxPrealloc))
+		if _, err = io.CopyN(buf, r, int64(l+2)); err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		b = buf.Bytes()
+	}
+
+	if err != nil {
+		return
+	}
+
+	if !bytes.Equal(b[l:], crlf) {
+		return nil, ErrProtocol
+	}
+
+	return b[:l], nil
+}
+
+// readLine will read a CRLF terminated line, the line terminator is not included
+func readLine(r *bufio.Reader) (line []byte, err error) {
+	for {
+		var (
+			b        []byte
+			isPrefix bool
+		)
+
+		if b, isPrefix, err = r.ReadLine(); err != nil {
+			return
+		}
+
+		line = append(line, b...)
+		if len(line) > maxLineLen {
+			err = ErrTooLarge
+			return
+		}
+
+		if !isPrefix {
+			return
+		}
+	}
+}
+
+// parseLen will parse a length header, lengths greater than max return ErrTooLarge
+func parseLen(b []byte, max int) (n int, err error) {
+	if n, err = strconv.Atoi(string(b)); err != nil || n < 0 {
+		return 0, ErrProtocol
+	}
+
+	if n > max {
+		return 0, ErrTooLarge
+	}
+
+	return
+}
+
+// writeReply will write a reply to w. Replies are one of simple, bulk, null, array, int64 or error
+func writeReply(w *bufio.Writer, r interface{}) {
+	switch v := r.(type) {
+	case simple:
+		w.WriteByte('+')
+		w.WriteString(string(v))
+	case error:
+		w.WriteByte('-')
+		w.WriteString(errorString(v))
+	case int64:
+		w.WriteByte(':')
+		w.WriteString(strconv.FormatInt(v, 10))
+	case bulk:
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(v)))
+		w.Write(crlf)
+		w.Write(v)
+	case null:
+		w.WriteString("$-1")
+	case array:
+		w.WriteByte('*')
+		w.WriteString(strconv.Itoa(len(v)))
+		w.Write(crlf)
+		for _, item := range v {
+			writeReply(w, item)
+		}
+
+		// Array items are terminated on their own
+		return
+	}
+
+	w.Write(crlf)
+}
+
+// errorString will return the message of an error reply. Messages are prefixed with ERR unless they already begin
+// with an error code, line breaks are replaced as they cannot be represented
+func errorString(err error) (msg string) {
+	msg = err.Error()
+	if _, ok := err.(codeError); !ok {
+		msg = "ERR " + msg
+	}
+
+	b := []byte(msg)
+	for i, c := range b {
+		if c == '\r' || c == '\n' {
+			b[i] = ' '
+		}
+	}
+
+	return string(b)
+}
+
+// codeError is an error reply which begins with it's own error code, such as EXECABORT
+type codeError string
+
+// Error will return the error message
+func (e codeError) Error() string {
+	return string(e)
+}
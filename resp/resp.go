@@ -0,0 +1,77 @@
+// Package resp serves a Hippy database over the Redis serialization protocol (RESP2), allowing redis-cli and
+// existing Redis client libraries to be used. Supported commands are GET, SET, DEL, EXISTS, KEYS, SCAN, INCR,
+// EXPIRE, MULTI, EXEC and DISCARD, along with PING, ECHO, COMMAND and QUIT for client compatibility.
+// Every command is executed as a Hippy transaction, a MULTI block is executed as a single transaction on EXEC
+package resp
+
+import (
+	"bufio"
+	"net"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/itsmontoya/hippy/internal/netserve"
+)
+
+// ErrIsClosed is returned when an action is attempted on a closed server
+const ErrIsClosed = netserve.ErrIsClosed
+
+// New returns a new RESP server for the provided database
+func New(db *hippy.Hippy) (s *Server) {
+	s = &Server{db: db}
+	s.Server = netserve.New(s.handle)
+	return
+}
+
+// Server serves a Hippy database over RESP. Listeners are served with ListenAndServe or Serve, Close will close all
+// listeners and connections, and wait for in-flight commands to complete
+// Note: The database is not closed by Close
+type Server struct {
+	*netserve.Server
+
+	db *hippy.Hippy
+}
+
+// handle will serve commands from a connection until it is closed
+func (s *Server) handle(conn net.Conn) {
+	var (
+		args [][]byte
+		err  error
+
+		r = bufio.NewReader(conn)
+		w = bufio.NewWriter(conn)
+		c = session{db: s.db}
+	)
+
+	for {
+		if args, err = readCommand(r); err != nil {
+			if err == ErrProtocol || err == ErrTooLarge {
+				// Let the client know why we are hanging up, the remainder of the request cannot be recovered from
+				writeReply(w, err)
+				w.Flush()
+			}
+
+			return
+		}
+
+		if len(args) == 0 {
+			// Empty inline commands are ignored
+			continue
+		}
+
+		quit := isCommand(args, "QUIT")
+		if quit {
+			writeReply(w, simple("OK"))
+		} else {
+			writeReply(w, c.exec(args))
+		}
+
+		// Only flush once all pipelined commands which have been received are answered
+		if r.Buffered() > 0 && !quit {
+			continue
+		}
+
+		if err = w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/hippy"
+)
+
+func TestServer(t *testing.T) {
+	var (
+		db   *hippy.Hippy
+		ln   net.Listener
+		conn net.Conn
+		err  error
+	)
+
+	opts, _ := hippy.NewOpts(nil)
+	opts.InMemory = true
+	if db, err = hippy.New("", "resp_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer db.Close()
+
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(db)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+
+	if conn, err = net.Dial("tcp", ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	do := func(args ...string) string {
+		send(t, conn, args...)
+		return readReply(t, r)
+	}
+
+	expect := func(exp string, args ...string) {
+		if rep := do(args...); rep != exp {
+			t.Errorf("%v: expected %q and received %q", args, exp, rep)
+		}
+	}
+
+	expect("+PONG", "PING")
+	expect("+OK", "SET", "greeting", "Hello!")
+	expect("Hello!", "GET", "greeting")
+	expect("(nil)", "GET", "missing")
+	expect(":2", "EXISTS", "greeting", "missing", "greeting")
+	expect("-ERR unknown command 'NOPE'", "NOPE")
+	expect("-ERR wrong number of arguments for 'get' command", "GET")
+
+	// Counters are stored as decimal strings
+	expect(":1", "INCR", "counter")
+	expect(":2", "incr", "counter")
+	expect("2", "GET", "counter")
+	expect("-ERR value is not an integer or out of range", "INCR", "greeting")
+
+	// Counters written by ReadWriteTx.Incr are binary, INCR rejects them rather than misreading them
+	if err = db.ReadWrite(func(txn *hippy.ReadWriteTx) (err error) {
+		_, err = txn.Incr("binary", 1)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect("-ERR "+errBinaryInteger.Error(), "INCR", "binary")
+
+	// Conditional sets
+	expect("(nil)", "SET", "greeting", "Hi", "NX")
+	expect("(nil)", "SET", "missing", "Hi", "XX")
+	expect("+OK", "SET", "greeting", "Hi", "XX")
+	expect("-ERR syntax error", "SET", "greeting", "Hi", "NX", "XX")
+
+	// INCR retains the expiry of a key
+	expect("+OK", "SET", "short", "5", "PX", "50")
+	expect(":6", "INCR", "short")
+	expect(":1", "EXPIRE", "greeting", "100")
+	expect(":0", "EXPIRE", "missing", "100")
+	time.Sleep(100 * time.Millisecond)
+	expect("(nil)", "GET", "short")
+	expect("Hi", "GET", "greeting")
+
+	// A non-positive expiry deletes the key
+	expect(":1", "EXPIRE", "greeting", "0")
+	expect("(nil)", "GET", "greeting")
+
+	for i := 0; i < 25; i++ {
+		expect("+OK", "SET", "user:"+strconv.Itoa(i), "x")
+	}
+
+	expect("[user:20 user:21 user:22 user:23 user:24]", "KEYS", "user:2?")
+	expect(":2", "DEL", "user:24", "user:23", "missing")
+
+	// Scan through the users in pages
+	var (
+		cursor = "0"
+		users  []string
+	)
+
+	for {
+		// Replies are formatted as [cursor [keys...]]
+		rep := strings.NewReplacer("[", "", "]", "").Replace(do("SCAN", cursor, "MATCH", "user:*", "COUNT", "4"))
+		page := strings.Fields(rep)
+		cursor = page[0]
+		users = append(users, page[1:]...)
+		if cursor == "0" {
+			break
+		}
+	}
+
+	if sort.Strings(users); len(users) != 23 || users[0] != "user:0" || users[22] != "user:9" {
+		t.Errorf("invalid scanned users: %v", users)
+	}
+
+	// MULTI blocks are executed as a single transaction on EXEC
+	expect("+OK", "MULTI")
+	expect("+QUEUED", "SET", "tx", "41")
+	expect("+QUEUED", "INCR", "tx")
+	expect("+QUEUED", "GET", "tx")
+	expect("-ERR MULTI calls can not be nested", "MULTI")
+	expect("[+OK :42 42]", "EXEC")
+	expect("-ERR EXEC without MULTI", "EXEC")
+
+	// Rejected commands discard the MULTI block
+	expect("+OK", "MULTI")
+	expect("+QUEUED", "SET", "tx", "0")
+	expect("-ERR unknown command 'NOPE'", "NOPE")
+	expect("-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	expect("+OK", "MULTI")
+	expect("+QUEUED", "SET", "tx", "0")
+	expect("+OK", "DISCARD")
+	expect("42", "GET", "tx")
+
+	// Pipelined and inline commands
+	if _, err = conn.Write([]byte("PING\r\n*2\r\n$3\r\nGET\r\n$2\r\ntx\r\nECHO pipelined\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{"+PONG", "42", "pipelined"} {
+		if rep := readReply(t, r); rep != exp {
+			t.Errorf("expected %q and received %q", exp, rep)
+		}
+	}
+
+	expect("+OK", "QUIT")
+	if _, err = r.ReadByte(); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+
+	if err = srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	before := ms.TotalAlloc
+
+	// Length headers alone must not allocate their claimed size
+	for _, req := range []string{"*1048576\r\n", "*1\r\n$67108864\r\n"} {
+		if _, err := readCommand(bufio.NewReader(strings.NewReader(req))); err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.Fatalf("%q: expected EOF and received %v", req, err)
+		}
+	}
+
+	runtime.ReadMemStats(&ms)
+	if n := ms.TotalAlloc - before; n > 4*1024*1024 {
+		t.Fatalf("expected headers to allocate less than 4MB and received %d bytes", n)
+	}
+
+	// Bulk strings larger than our pre-allocation are read in full
+	v := strings.Repeat("v", maxPrealloc*3)
+	args, err := readCommand(bufio.NewReader(strings.NewReader("*2\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(args) != 2 || string(args[0]) != "SET" || string(args[1]) != v {
+		t.Fatalf("invalid arguments: %d", len(args))
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"*a*b", "xaxxb", true},
+		{"*a*b", "xaxxbc", false},
+		{"a**b", "axxb", true},
+		{"*[ab]?", "xxbz", true},
+		{"a*", "", false},
+		{`\`, `\`, true},
+	}
+
+	for _, tt := range tests {
+		if match(tt.pattern, tt.key) != tt.match {
+			t.Errorf("match(%q, %q) should be %v", tt.pattern, tt.key, tt.match)
+		}
+	}
+
+	// Patterns with many stars must not backtrack exponentially against keys they do not match
+	key := strings.Repeat("a", 4096)
+	start := time.Now()
+	if match("*a*a*a*a*a*a*a*a*a*a*b", key) {
+		t.Fatal("pattern should not match")
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("matching took %v", d)
+	}
+}
+
+// send will write a command as an array of bulk strings
+func send(t *testing.T, conn net.Conn, args ...string) {
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b = append(b, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+
+	if _, err := conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readReply will read a reply as a string. Simple strings, errors and integers retain their type prefix,
+// bulk strings are returned as is, null is returned as (nil) and arrays are space separated within brackets
+func readReply(t *testing.T, r *bufio.Reader) string {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b[:n])
+
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]string, n)
+		for i := range items {
+			items[i] = readReply(t, r)
+		}
+
+		return "[" + strings.Join(items, " ") + "]"
+
+	default:
+		return line
+	}
+}
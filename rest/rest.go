@@ -0,0 +1,427 @@
+// Package rest exposes a Hippy database as an HTTP/JSON API. The handler may be mounted within an existing server,
+// use http.StripPrefix when mounting it beneath a path.
+//
+//	GET    /keys/{key}                        Value of a key, 404 when it does not exist
+//	PUT    /keys/{key}?ttl={duration}         Set the value of a key to the request body, with an optional TTL
+//	DELETE /keys/{key}                        Delete a key
+//	GET    /keys?prefix=&after=&limit=        List keys with a prefix in key order, one page at a time
+//	POST   /batch                             Execute a batch of operations as a single transaction
+//	GET    /backup                            Download a consistent snapshot, which may be restored with LoadFrom
+//
+// Errors are returned as a JSON object with an "error" field
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+const (
+	// DefaultLimit is the number of keys listed per page when a limit is not provided
+	DefaultLimit = 100
+	// MaxLimit is the maximum number of keys listed per page
+	MaxLimit = 10000
+	// DefaultMaxBodyLen is the default maximum length of a request body
+	DefaultMaxBodyLen = 32 * 1024 * 1024
+)
+
+const (
+	// ErrNotFound is returned when a key or route does not exist
+	ErrNotFound = errors.Error("not found")
+	// ErrMethodNotAllowed is returned when a route does not support the request method
+	ErrMethodNotAllowed = errors.Error("method not allowed")
+	// ErrInvalidLimit is returned when a listing limit is not a positive integer
+	ErrInvalidLimit = errors.Error("invalid limit")
+	// ErrInvalidOp is returned when a batch contains an unknown operation
+	ErrInvalidOp = errors.Error("invalid operation")
+	// ErrTooLarge is returned when a request body exceeds MaxBodyLen
+	ErrTooLarge = errors.Error("request body too large")
+	// ErrInvalidRequest is returned when a request body cannot be decoded
+	ErrInvalidRequest = errors.Error("invalid request")
+)
+
+// New returns a new handler for the provided database
+func New(db *hippy.Hippy) *Handler {
+	return &Handler{
+		db:         db,
+		MaxBodyLen: DefaultMaxBodyLen,
+	}
+}
+
+// Handler is an http.Handler which serves a Hippy database
+type Handler struct {
+	db *hippy.Hippy
+
+	// Maximum length of a request body
+	MaxBodyLen int64
+	// Directory backups are spooled to before they are sent, the default directory for temporary files is used when empty
+	SpoolDir string
+}
+
+// ServeHTTP will serve an HTTP request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path := r.URL.Path; {
+	case strings.HasPrefix(path, "/keys/"):
+		h.serveKey(w, r, strings.TrimPrefix(path, "/keys/"))
+	case path == "/keys":
+		h.serveKeys(w, r)
+	case path == "/batch":
+		h.serveBatch(w, r)
+	case path == "/backup":
+		h.serveBackup(w, r)
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
+
+// serveKey will serve requests for a single key
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, key string) {
+	var (
+		val []byte
+		ok  bool
+		err error
+	)
+
+	if len(key) == 0 {
+		writeError(w, hippy.ErrInvalidKey)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		err = h.db.ReadCtx(r.Context(), func(txn *hippy.ReadTx) error {
+			val, ok = txn.Get(key)
+			return nil
+		})
+
+		if err == nil && !ok {
+			err = ErrNotFound
+		}
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(val)))
+		w.Write(val)
+
+	case http.MethodPut:
+		var ttl time.Duration
+		if s := r.URL.Query().Get("ttl"); len(s) > 0 {
+			if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+				writeError(w, hippy.ErrInvalidTTL)
+				return
+			}
+		}
+
+		if val, err = h.readBody(r); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		err = h.db.ReadWriteCtx(r.Context(), func(txn *hippy.ReadWriteTx) error {
+			if ttl > 0 {
+				return txn.PutWithTTL(key, val, ttl)
+			}
+
+			return txn.Put(key, val)
+		})
+
+		writeStatus(w, err)
+
+	case http.MethodDelete:
+		writeStatus(w, h.db.ReadWriteCtx(r.Context(), func(txn *hippy.ReadWriteTx) error {
+			txn.Del(key)
+			return nil
+		}))
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
+
+// serveKeys will serve a page of keys. Keys are listed in key order, the next page is requested by providing the
+// returned next value as after. Next is empty once all keys have been listed
+func (h *Handler) serveKeys(w http.ResponseWriter, r *http.Request) {
+	var (
+		q      = r.URL.Query()
+		prefix = q.Get("prefix")
+		after  = q.Get("after")
+		limit  = DefaultLimit
+		page   keysPage
+		err    error
+	)
+
+	if r.Method != http.MethodGet {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+
+	if s := q.Get("limit"); len(s) > 0 {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > MaxLimit {
+			writeError(w, ErrInvalidLimit)
+			return
+		}
+	}
+
+	var (
+		keys []string
+		more bool
+	)
+
+	if err = h.db.ReadCtx(r.Context(), func(txn *hippy.ReadTx) error {
+		keys, more = txn.KeysAfter(prefix, after, limit)
+		return nil
+	}); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if more {
+		page.Next = keys[len(keys)-1]
+	}
+
+	page.Keys = keys
+	if page.Keys == nil {
+		// Always list an array, even when empty
+		page.Keys = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// serveBatch will execute a batch of operations as a single transaction. Batches without writes are executed as a read
+// transaction, allowing read-only databases to be served
+// Note: No changes are committed if any operation fails
+func (h *Handler) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var (
+		body []byte
+		req  batchRequest
+		err  error
+	)
+
+	if r.Method != http.MethodPost {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+
+	if body, err = h.readBody(r); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		writeError(w, ErrInvalidRequest)
+		return
+	}
+
+	readOnly := true
+	for _, op := range req.Ops {
+		switch op.Op {
+		case "get":
+		case "put", "del":
+			readOnly = false
+		default:
+			writeError(w, ErrInvalidOp)
+			return
+		}
+	}
+
+	rs := make([]batchResult, len(req.Ops))
+	if readOnly {
+		err = h.db.ReadCtx(r.Context(), func(txn *hippy.ReadTx) error {
+			for i, op := range req.Ops {
+				rs[i].Value, rs[i].OK = txn.Get(op.Key)
+			}
+
+			return nil
+		})
+	} else {
+		err = h.db.ReadWriteCtx(r.Context(), func(txn *hippy.ReadWriteTx) (err error) {
+			for i, op := range req.Ops {
+				if err = op.exec(txn, &rs[i]); err != nil {
+					return
+				}
+			}
+
+			return
+		})
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, batchResponse{Results: rs})
+}
+
+// serveBackup will stream a snapshot of the database. The snapshot is spooled to a temporary file first, so that writers
+// are only blocked for as long as it takes to write the file rather than for as long as the client takes to read it
+func (h *Handler) serveBackup(w http.ResponseWriter, r *http.Request) {
+	var (
+		f   *os.File
+		fi  os.FileInfo
+		err error
+	)
+
+	if r.Method != http.MethodGet {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+
+	if f, err = ioutil.TempFile(h.SpoolDir, "hippy-backup-"); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = h.db.Backup(f); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if fi, err = f.Stat(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="backup.hdb"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	// Once our response has begun we cannot report errors, a client which receives a partial snapshot will be missing
+	// it's checkpoint, which LoadFrom rejects
+	io.Copy(w, f)
+}
+
+// readBody will read a request body, ErrTooLarge is returned when it exceeds our maximum body length
+func (h *Handler) readBody(r *http.Request) (body []byte, err error) {
+	if body, err = io.ReadAll(io.LimitReader(r.Body, h.MaxBodyLen+1)); err != nil {
+		return
+	}
+
+	if int64(len(body)) > h.MaxBodyLen {
+		err = ErrTooLarge
+	}
+
+	return
+}
+
+// keysPage is a page of keys
+type keysPage struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"`
+}
+
+// batchRequest is a batch of operations
+type batchRequest struct {
+	Ops []batchOp `json:"ops"`
+}
+
+// batchOp is an operation within a batch, values are base64 encoded
+type batchOp struct {
+	Op    string `json:"op"` // One of get, put or del
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"` // Optional TTL for put operations, such as "1m30s"
+}
+
+// exec will execute an operation within a read/write transaction
+func (op *batchOp) exec(txn *hippy.ReadWriteTx, r *batchResult) (err error) {
+	switch op.Op {
+	case "get":
+		r.Value, r.OK = txn.Get(op.Key)
+	case "put":
+		if len(op.TTL) == 0 {
+			return txn.Put(op.Key, op.Value)
+		}
+
+		var ttl time.Duration
+		if ttl, err = time.ParseDuration(op.TTL); err != nil {
+			return hippy.ErrInvalidTTL
+		}
+
+		return txn.PutWithTTL(op.Key, op.Value, ttl)
+	case "del":
+		txn.Del(op.Key)
+	}
+
+	return
+}
+
+// batchResponse is the response of a batch, containing a result for each operation
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// batchResult is the result of an operation, values are base64 encoded
+type batchResult struct {
+	OK    bool   `json:"ok,omitempty"`    // Key exists, set for get operations
+	Value []byte `json:"value,omitempty"` // Value for get operations
+}
+
+// errorResponse is the body of an error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeStatus will write a No Content response, or an error response when err is not nil
+func writeStatus(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeError will write an error response with a status code matching the error
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusCode(err), errorResponse{Error: err.Error()})
+}
+
+// writeJSON will write a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// statusCode will return the HTTP status code for an error
+func statusCode(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case ErrTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case hippy.ErrReadOnly:
+		return http.StatusForbidden
+	case hippy.ErrIsClosed, context.Canceled, context.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	case hippy.ErrInvalidKey, hippy.ErrInvalidTTL, ErrInvalidLimit, ErrInvalidOp, ErrInvalidRequest:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,164 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/itsmontoya/hippy"
+)
+
+func TestHandler(t *testing.T) {
+	var (
+		db  *hippy.Hippy
+		err error
+	)
+
+	opts, _ := hippy.NewOpts(nil)
+	opts.InMemory = true
+	if db, err = hippy.New("", "rest_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer db.Close()
+
+	srv := httptest.NewServer(http.StripPrefix("/db", New(db)))
+	defer srv.Close()
+
+	do := func(method, path, body string) (status int, resp string) {
+		req, err := http.NewRequest(method, srv.URL+"/db"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res.StatusCode, string(b)
+	}
+
+	expect := func(status int, resp, method, path, body string) {
+		s, r := do(method, path, body)
+		if s != status || strings.TrimSpace(r) != resp {
+			t.Errorf("%s %s: expected %d %q and received %d %q", method, path, status, resp, s, r)
+		}
+	}
+
+	expect(http.StatusNoContent, "", "PUT", "/keys/greeting", "Hello!")
+	expect(http.StatusOK, "Hello!", "GET", "/keys/greeting", "")
+	expect(http.StatusNotFound, `{"error":"not found"}`, "GET", "/keys/missing", "")
+	expect(http.StatusBadRequest, `{"error":"invalid ttl, must be greater than zero"}`, "PUT", "/keys/greeting?ttl=nope", "")
+	expect(http.StatusMethodNotAllowed, `{"error":"method not allowed"}`, "POST", "/keys/greeting", "")
+	expect(http.StatusNoContent, "", "DELETE", "/keys/greeting", "")
+	expect(http.StatusNotFound, `{"error":"not found"}`, "GET", "/keys/greeting", "")
+
+	// Keys may contain slashes
+	expect(http.StatusNoContent, "", "PUT", "/keys/a/b", "c")
+	expect(http.StatusOK, "c", "GET", "/keys/a/b", "")
+
+	for i := 0; i < 25; i++ {
+		expect(http.StatusNoContent, "", "PUT", "/keys/user:"+strconv.Itoa(i), "x")
+	}
+
+	// Page through the users
+	var (
+		users []string
+		after string
+	)
+
+	for {
+		var page keysPage
+		_, resp := do("GET", "/keys?prefix=user:&limit=10&after="+after, "")
+		if err = json.Unmarshal([]byte(resp), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		users = append(users, page.Keys...)
+		if after = page.Next; len(after) == 0 {
+			break
+		}
+	}
+
+	if len(users) != 25 || users[0] != "user:0" || users[24] != "user:9" {
+		t.Errorf("invalid users: %v", users)
+	}
+
+	expect(http.StatusBadRequest, `{"error":"invalid limit"}`, "GET", "/keys?limit=0", "")
+
+	// A batch is a single transaction, reads observe earlier writes within the batch
+	expect(http.StatusOK, `{"results":[{},{},{"ok":true,"value":"SGlwcHk="}]}`, "POST", "/batch",
+		`{"ops":[{"op":"put","key":"name","value":"SGlwcHk="},{"op":"del","key":"a/b"},{"op":"get","key":"name"}]}`)
+
+	// A failed operation aborts the entire batch
+	expect(http.StatusBadRequest, `{"error":"invalid key"}`, "POST", "/batch",
+		`{"ops":[{"op":"del","key":"name"},{"op":"put","key":"`+strings.Repeat("k", 300)+`"}]}`)
+	expect(http.StatusOK, "Hippy", "GET", "/keys/name", "")
+	expect(http.StatusBadRequest, `{"error":"invalid operation"}`, "POST", "/batch", `{"ops":[{"op":"nope"}]}`)
+	expect(http.StatusBadRequest, `{"error":"invalid request"}`, "POST", "/batch", `{`)
+
+	// Restore a backup into a fresh database
+	status, backup := do("GET", "/backup", "")
+	if status != http.StatusOK {
+		t.Fatalf("invalid backup status: %d", status)
+	}
+
+	if err = os.WriteFile("testing.backup", []byte(backup), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing.backup")
+
+	var restored *hippy.Hippy
+	if restored, err = hippy.New("", "rest_test_restored", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer restored.Close()
+
+	if err = restored.LoadFrom("testing.backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	restored.Read(func(txn *hippy.ReadTx) error {
+		if v, _ := txn.Get("name"); string(v) != "Hippy" {
+			t.Errorf("invalid restored value: %s", v)
+		}
+
+		if n := len(txn.Keys()); n != 26 {
+			t.Errorf("expected 26 restored keys and received %d", n)
+		}
+
+		return nil
+	})
+
+	// Requests stop waiting on the database once their client has gone away
+	locked, release := make(chan struct{}), make(chan struct{})
+	go db.Write(func(*hippy.WriteTx) error {
+		close(locked)
+		<-release
+		return nil
+	})
+
+	<-locked
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := httptest.NewRecorder()
+	New(db).ServeHTTP(rec, httptest.NewRequest("GET", "/keys/name", nil).WithContext(ctx))
+	close(release)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d for a cancelled request and received %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
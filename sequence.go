@@ -0,0 +1,95 @@
+package hippy
+
+import "sync"
+
+// Sequence hands out monotonically increasing IDs. IDs are leased from the log in batches so
+// that the database write lock is only taken once per batch, rather than once per ID
+// Note: IDs within a lease which are never handed out (E.g. due to a crash) are skipped on restart
+type Sequence struct {
+	mux sync.Mutex
+
+	h    *Hippy
+	name string
+
+	next   uint64 // Last ID handed out
+	leased uint64 // Upper bound of our current lease
+	lease  uint64 // Number of IDs to lease at a time
+}
+
+// Next will return the next ID for the sequence
+func (s *Sequence) Next() (id uint64, err error) {
+	s.mux.Lock()
+	if s.next >= s.leased {
+		// Our lease has been exhausted, acquire a new one
+		if err = s.renew(); err != nil {
+			goto END
+		}
+	}
+
+	s.next++
+	id = s.next
+
+END:
+	s.mux.Unlock()
+	return
+}
+
+// Release will return any unused IDs within the current lease to the log, if no other lease has been taken since
+func (s *Sequence) Release() (err error) {
+	s.mux.Lock()
+	s.h.mux.Lock()
+	if s.h.closed {
+		err = ErrIsClosed
+		goto END
+	}
+
+	if s.h.ro {
+		err = ErrReadOnly
+		goto END
+	}
+
+	if s.leased == 0 || s.h.seqs[s.name] != s.leased {
+		// We do not hold the most recent lease, nothing to release
+		goto END
+	}
+
+	if err = s.h.lease(s.name, s.next); err != nil {
+		goto END
+	}
+
+	s.leased = s.next
+
+END:
+	s.h.mux.Unlock()
+	s.mux.Unlock()
+	return
+}
+
+// renew will lease a new range of IDs
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (s *Sequence) renew() (err error) {
+	var upper uint64
+	s.h.mux.Lock()
+	if s.h.closed {
+		err = ErrIsClosed
+		goto END
+	}
+
+	if s.h.ro {
+		err = ErrReadOnly
+		goto END
+	}
+
+	// Our range starts at the most recently persisted upper bound
+	s.next = s.h.seqs[s.name]
+	upper = s.next + s.lease
+	if err = s.h.lease(s.name, upper); err != nil {
+		goto END
+	}
+
+	s.leased = upper
+
+END:
+	s.h.mux.Unlock()
+	return
+}
@@ -0,0 +1,132 @@
+// Package server serves a Hippy database over TCP. Each request is a batch of operations which is executed as a single
+// transaction, request and response frames are length-prefixed
+package server
+
+import (
+	"bufio"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/itsmontoya/hippy/internal/netserve"
+	"github.com/itsmontoya/hippy/internal/wire"
+)
+
+// ErrIsClosed is returned when an action is attempted on a closed server
+const ErrIsClosed = netserve.ErrIsClosed
+
+// New returns a new server for the provided database
+func New(db *hippy.Hippy) (s *Server) {
+	s = &Server{db: db}
+	s.Server = netserve.New(s.handle)
+	return
+}
+
+// Server serves a Hippy database. Listeners are served with ListenAndServe or Serve, Close will close all
+// listeners and connections, and wait for in-flight requests to complete
+// Note: The database is not closed by Close
+type Server struct {
+	*netserve.Server
+
+	db *hippy.Hippy
+}
+
+// handle will serve requests from a connection until it is closed
+func (s *Server) handle(conn net.Conn) {
+	var (
+		b   []byte
+		ops []wire.Op
+		rs  []wire.Result
+		err error
+
+		r = bufio.NewReader(conn)
+		w = bufio.NewWriter(conn)
+	)
+
+	for {
+		if b, err = wire.ReadFrame(r, b); err != nil {
+			// The connection has closed or is unusable, a partial frame cannot be recovered from
+			return
+		}
+
+		if ops, err = wire.DecodeRequest(b); err == nil {
+			rs, err = s.exec(ops)
+		}
+
+		if err = wire.WriteFrame(w, wire.EncodeResponse(rs, err)); err != nil {
+			return
+		}
+
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec will execute a batch of operations as a single transaction. Batches without writes are executed as a read
+// transaction, allowing read-only databases to be served
+func (s *Server) exec(ops []wire.Op) (rs []wire.Result, err error) {
+	rs = make([]wire.Result, len(ops))
+	if isReadOnly(ops) {
+		err = s.db.Read(func(txn *hippy.ReadTx) error {
+			for i, op := range ops {
+				rs[i] = read(txn.Get, txn.Keys, op)
+			}
+
+			return nil
+		})
+
+		return
+	}
+
+	err = s.db.ReadWrite(func(txn *hippy.ReadWriteTx) (err error) {
+		for i, op := range ops {
+			switch op.Type {
+			case wire.OpPut:
+				err = txn.Put(op.Key, op.Value)
+			case wire.OpDel:
+				txn.Del(op.Key)
+			default:
+				rs[i] = read(txn.Get, txn.Keys, op)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+// isReadOnly will return whether or not a batch of operations contains no writes
+func isReadOnly(ops []wire.Op) bool {
+	for _, op := range ops {
+		if op.Type == wire.OpPut || op.Type == wire.OpDel {
+			return false
+		}
+	}
+
+	return true
+}
+
+// read will return the result of a read operation
+func read(get func(string) ([]byte, bool), keys func() []string, op wire.Op) (r wire.Result) {
+	switch op.Type {
+	case wire.OpGet:
+		r.Value, r.OK = get(op.Key)
+	case wire.OpKeys:
+		for _, k := range keys() {
+			if strings.HasPrefix(k, op.Key) {
+				r.Keys = append(r.Keys, k)
+			}
+		}
+
+		sort.Strings(r.Keys)
+	}
+
+	return
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/itsmontoya/hippy"
+	"github.com/itsmontoya/hippy/client"
+)
+
+func TestServer(t *testing.T) {
+	var (
+		db   *hippy.Hippy
+		ln   net.Listener
+		c    *client.Client
+		val  []byte
+		ok   bool
+		keys []string
+		rs   []client.Result
+		err  error
+	)
+
+	opts, _ := hippy.NewOpts(nil)
+	opts.InMemory = true
+	if db, err = hippy.New("", "server_test", opts); err != nil {
+		t.Fatal("Error opening:", err)
+	}
+	defer db.Close()
+
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(db)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+
+	if c, err = client.Dial(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.Put("greeting", []byte("Hello!")); err != nil {
+		t.Fatal(err)
+	}
+
+	if val, ok, err = c.Get("greeting"); err != nil || !ok || string(val) != "Hello!" {
+		t.Fatalf("invalid value: %s (%v)", val, err)
+	}
+
+	if _, ok, err = c.Get("missing"); err != nil || ok {
+		t.Fatalf("expected missing key (%v)", err)
+	}
+
+	// A batch is a single transaction, reads observe earlier writes within the batch
+	b := new(client.Batch).
+		Put("user:1", []byte("Hippy")).
+		Put("user:2", []byte("Potamus")).
+		Del("greeting").
+		Get("user:1").
+		Keys("user:")
+
+	if rs, err = c.Do(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) != b.Len() {
+		t.Fatalf("expected %d results and received %d", b.Len(), len(rs))
+	}
+
+	if !rs[3].OK || string(rs[3].Value) != "Hippy" {
+		t.Errorf("invalid batch value: %s", rs[3].Value)
+	}
+
+	if strings.Join(rs[4].Keys, ",") != "user:1,user:2" {
+		t.Errorf("invalid batch keys: %v", rs[4].Keys)
+	}
+
+	// A failed operation aborts the entire batch
+	if _, err = c.Do(new(client.Batch).Del("user:1").Put(strings.Repeat("k", 300), nil)); err != hippy.ErrInvalidKey {
+		t.Fatalf("expected %v and received %v", hippy.ErrInvalidKey, err)
+	}
+
+	if keys, err = c.Keys(""); err != nil || strings.Join(keys, ",") != "user:1,user:2" {
+		t.Fatalf("invalid keys: %v (%v)", keys, err)
+	}
+
+	if _, ok, _ = c.Get("greeting"); ok {
+		t.Error("deleted key exists")
+	}
+
+	if err = srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = c.Get("greeting"); err == nil {
+		t.Error("expected an error from a closed server")
+	}
+}
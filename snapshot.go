@@ -0,0 +1,236 @@
+package hippy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"time"
+
+	"github.com/missionMeteora/toolkit/errors"
+)
+
+// ErrInvalidSnapshot is returned when a snapshot does not end with a checkpoint, such as when it has been truncated
+const ErrInvalidSnapshot = errors.Error("invalid snapshot, checkpoint not found")
+
+// SaveTo will save a snapshot of the database to the provided path. The snapshot is written to a temporary file which
+// replaces the destination once it has been synced, an existing snapshot is never left partially written.
+// Readers are not blocked while the snapshot is written, writers are blocked until it has been synced
+// Note: Snapshots are encoded with our middlewares, they must be loaded by an instance with the same middlewares
+func (h *Hippy) SaveTo(path string) (err error) {
+	var (
+		f   *os.File
+		tmp = path + ".tmp"
+	)
+
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	h.mux.RLock()
+	if h.closed {
+		err = ErrIsClosed
+		goto END
+	}
+
+	if f, err = os.Create(tmp); err != nil {
+		goto END
+	}
+
+	if err = h.writeSnapshot(f); err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		// Our snapshot is incomplete, remove it
+		os.Remove(tmp)
+		goto END
+	}
+
+	err = os.Rename(tmp, path)
+
+END:
+	h.mux.RUnlock()
+	return
+}
+
+// Backup will write a snapshot of the database to w, in the same format as SaveTo. The snapshot is consistent, writers
+// are blocked until it has been written in full
+// Note: A slow writer delays all writes to the database, spool to a file first when w may be slow
+func (h *Hippy) Backup(w io.Writer) (err error) {
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	h.mux.RLock()
+	if h.closed {
+		err = ErrIsClosed
+	} else {
+		err = h.writeSnapshot(w)
+	}
+	h.mux.RUnlock()
+	return
+}
+
+// writeSnapshot will write a snapshot to w
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) writeSnapshot(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	if err = h.snapshot(func(b []byte) (err error) {
+		if _, err = bw.Write(b); err != nil {
+			return
+		}
+
+		return bw.WriteByte(_newline)
+	}); err != nil {
+		return
+	}
+
+	return bw.Flush()
+}
+
+// LoadFrom will replace the contents of the database with a snapshot saved by SaveTo. The replacement is committed as a
+// single transaction, sequence leases are only ever moved forward so that previously issued IDs are not re-used
+func (h *Hippy) LoadFrom(path string) (err error) {
+	var (
+		f  *os.File
+		rs []record
+		ls leases
+	)
+
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+
+	rs, ls, err = h.readSnapshot(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	if err = h.enter(); err != nil {
+		return
+	}
+	defer h.exit()
+
+	h.mux.Lock()
+	if h.closed {
+		err = ErrIsClosed
+		goto END
+	}
+
+	if h.ro {
+		err = ErrReadOnly
+		goto END
+	}
+
+	for name, upper := range ls {
+		if upper <= h.seqs[name] {
+			continue
+		}
+
+		if err = h.lease(name, upper); err != nil {
+			goto END
+		}
+	}
+
+	err = h.write(h.replacement(rs))
+
+END:
+	h.mux.Unlock()
+	return
+}
+
+// readSnapshot will read the records and sequence leases of a snapshot
+func (h *Hippy) readSnapshot(r *bufio.Reader) (rs []record, ls leases, err error) {
+	var (
+		b    []byte
+		key  string
+		act  action
+		rerr error
+	)
+
+	ls = make(leases)
+	for {
+		if b, rerr = r.ReadBytes(_newline); len(b) > 0 && b[len(b)-1] == _newline {
+			b = b[:len(b)-1]
+		}
+
+		if len(b) > 0 {
+			if key, act, err = h.parseLogLine(bytes.NewBuffer(b)); err != nil {
+				return
+			}
+
+			switch act.a {
+			case _put:
+				rs = append(rs, record{key: key, act: act})
+			case _bput:
+				if _, _, err = parseBucketBody(act.b); err != nil {
+					return
+				}
+
+				rs = append(rs, record{key: key, act: act})
+			case _lease:
+				var n int64
+				if n, err = DecodeInt64(act.b); err != nil {
+					return
+				}
+
+				ls[key] = uint64(n)
+			case _checkpoint:
+				// We have reached the end of our snapshot
+				return
+			}
+		}
+
+		if rerr == io.EOF {
+			err = ErrInvalidSnapshot
+			return
+		} else if rerr != nil {
+			err = rerr
+			return
+		}
+	}
+}
+
+// replacement will return the transaction changes which replace our contents with the provided records
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) replacement(rs []record) (a map[string]action, b bucketChanges) {
+	now := time.Now().UnixNano()
+	a = make(map[string]action, len(h.s)+len(rs))
+	b = make(bucketChanges)
+
+	for k := range h.s {
+		// Delete all existing keys, keys present within the snapshot will be replaced by a put
+		a[k] = action{a: _del}
+	}
+
+	for name := range h.b {
+		// Drop all existing buckets
+		b.drop(name)
+	}
+
+	for _, r := range rs {
+		if r.act.a == _put {
+			if r.act.e > 0 && r.act.e <= now {
+				// Key has expired since the snapshot was saved
+				continue
+			}
+
+			a[r.key] = r.act
+			continue
+		}
+
+		// Bucket records have already been validated by readSnapshot
+		k, v, _ := parseBucketBody(r.act.b)
+		b.get(r.key).a[k] = action{a: _put, b: v}
+	}
+
+	return
+}
@@ -0,0 +1,175 @@
+package hippy
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// histogramBounds are the upper bounds of our histogram buckets
+var histogramBounds = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// Stats are runtime statistics for a database, counters begin at zero when the database is opened
+type Stats struct {
+	// Keys is the number of root keys, including expired keys which have not yet been reaped
+	Keys int
+	// Buckets is the number of buckets
+	Buckets int
+	// BucketKeys is the number of keys across all buckets
+	BucketKeys int
+	// ValueBytes is the total length of all root and bucket values
+	ValueBytes int64
+
+	// LogSize is the size of the log in bytes, -1 when the backend does not implement Sizer
+	LogSize int64
+	// ArchiveSize is the size of the archive in bytes, -1 when the backend does not implement Sizer
+	ArchiveSize int64
+	// Records is the number of records written to the log since it was last compacted
+	Records int
+	// BytesWritten is the number of bytes appended to the log, including those written by compaction
+	BytesWritten int64
+
+	// Commits is the number of committed transactions
+	Commits uint64
+	// FailedCommits is the number of transactions which failed to commit, such as those rejected by a hook
+	FailedCommits uint64
+
+	// FlushLatency is the time taken to flush the log
+	FlushLatency Histogram
+	// ArchiveDuration is the time taken by each successful archive
+	ArchiveDuration Histogram
+	// CompactDuration is the time taken by each successful compaction
+	CompactDuration Histogram
+	// ReadLockWait is the time read transactions waited to acquire the lock
+	ReadLockWait Histogram
+	// WriteLockWait is the time write and read/write transactions waited to acquire the lock
+	WriteLockWait Histogram
+}
+
+// Histogram is a distribution of durations
+type Histogram struct {
+	// Bounds are the upper bounds of each bucket, in ascending order
+	Bounds []time.Duration
+	// Counts are the number of observations within each bucket, an observation is counted by the first bucket which
+	// it does not exceed. Counts contains an additional final bucket for observations exceeding every bound
+	Counts []uint64
+	// Count is the total number of observations
+	Count uint64
+	// Sum is the total of all observations
+	Sum time.Duration
+}
+
+// Stats will return runtime statistics for the database
+func (h *Hippy) Stats() (s Stats) {
+	h.mux.RLock()
+	s.Keys = len(h.s)
+	s.Buckets = len(h.b)
+	for _, b := range h.b {
+		s.BucketKeys += len(b)
+	}
+
+	s.ValueBytes = h.st.valueBytes
+	s.Records = h.st.records
+	s.BytesWritten = h.st.bytesWritten
+	s.Commits = h.st.commits
+	s.FailedCommits = h.st.failed
+	s.LogSize = backendSize(h.f)
+	s.ArchiveSize = backendSize(h.af)
+	h.mux.RUnlock()
+
+	s.FlushLatency = h.st.flush.snapshot()
+	s.ArchiveDuration = h.st.archive.snapshot()
+	s.CompactDuration = h.st.compact.snapshot()
+	s.ReadLockWait = h.st.rlock.snapshot()
+	s.WriteLockWait = h.st.wlock.snapshot()
+	return
+}
+
+// backendSize will return the size of a backend, -1 is returned when the size is not known
+func backendSize(b Backend) int64 {
+	sz, ok := b.(Sizer)
+	if !ok {
+		return -1
+	}
+
+	n, err := sz.Size()
+	if err != nil {
+		return -1
+	}
+
+	return n
+}
+
+// stats are our internal runtime statistics
+// Note: Histograms are updated atomically, all other fields are guarded by our lock
+type stats struct {
+	flush   histogram // Flush latency
+	archive histogram // Archive duration
+	compact histogram // Compaction duration
+	rlock   histogram // Read lock wait time
+	wlock   histogram // Write lock wait time
+
+	valueBytes   int64  // Total length of all values
+	bytesWritten int64  // Bytes appended to our log
+	commits      uint64 // Committed transactions
+	failed       uint64 // Transactions which failed to commit
+	records      int    // Records written to our log since our last compaction
+}
+
+// putValue will account for a value being replaced
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (st *stats) putValue(old, new []byte) {
+	st.valueBytes += int64(len(new) - len(old))
+}
+
+// histogram is a distribution of durations which is safe for concurrent use
+type histogram struct {
+	counts [len(histogramBounds) + 1]uint64 // One for each of our bounds, followed by our unbounded bucket
+	count  uint64
+	sum    int64
+}
+
+// observe will add an observation
+func (hg *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(histogramBounds) && d > histogramBounds[i] {
+		i++
+	}
+
+	atomic.AddUint64(&hg.counts[i], 1)
+	atomic.AddUint64(&hg.count, 1)
+	atomic.AddInt64(&hg.sum, int64(d))
+}
+
+// since will add an observation of the time elapsed since start
+func (hg *histogram) since(start time.Time) {
+	hg.observe(time.Since(start))
+}
+
+// snapshot will return a copy of the histogram
+// Note: Concurrent observations may be partially reflected
+func (hg *histogram) snapshot() (s Histogram) {
+	s.Bounds = append([]time.Duration(nil), histogramBounds[:]...)
+	s.Counts = make([]uint64, len(hg.counts))
+	for i := range hg.counts {
+		s.Counts[i] = atomic.LoadUint64(&hg.counts[i])
+	}
+
+	s.Count = atomic.LoadUint64(&hg.count)
+	s.Sum = time.Duration(atomic.LoadInt64(&hg.sum))
+	return
+}
@@ -11,10 +11,9 @@ import (
 
 func main() {
 	var (
-		db  *hippy.Hippy
-		err error
-
-		bb []byte
+		db   *hippy.Hippy
+		opts hippy.Opts
+		err  error
 
 		testKeys = []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
 		testVal  = []byte("Hello!")
@@ -22,7 +21,12 @@ func main() {
 		done int64
 	)
 
-	if db, err = hippy.New("test.db"); err != nil {
+	if opts, err = hippy.NewOpts(nil); err != nil {
+		fmt.Println("Error creating options:", err)
+		return
+	}
+
+	if db, err = hippy.New("./", "test", opts); err != nil {
 		fmt.Println("Error opening:", err)
 		return
 	}
@@ -39,7 +43,7 @@ func main() {
 			for i := 0; i < 1000; i++ {
 				for _, k := range testKeys {
 					txn.Put(k, testVal)
-					bb, _ = txn.Get(k)
+					txn.Get(k)
 				}
 			}
 			return
@@ -0,0 +1,133 @@
+package hippy
+
+import "time"
+
+const (
+	// TraceBegin is traced once a transaction has acquired it's lock, Duration is the time spent waiting for the lock
+	TraceBegin TraceOp = iota
+	// TraceCommit is traced once a transaction with changes has been committed or has failed to commit, Duration is the
+	// time taken to write, flush, and apply it's changes. Keys is the number of keys changed
+	TraceCommit
+	// TraceFlush is traced once the log has been flushed, Lines is the number of lines flushed
+	TraceFlush
+	// TraceArchive is traced once an archive has completed or failed, Lines is the number of lines archived
+	TraceArchive
+	// TraceCompact is traced once a compaction has completed or failed, Keys is the number of keys within the snapshot and
+	// Lines is the number of lines written
+	TraceCompact
+)
+
+// Logger is a structured logger, args are alternating keys and values. *slog.Logger satisfies Logger
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger is a Logger which discards all messages, it is used when a logger is not provided
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// TraceOp is a traced operation
+type TraceOp uint8
+
+// String will return the name of a traced operation
+func (op TraceOp) String() string {
+	switch op {
+	case TraceBegin:
+		return "begin"
+	case TraceCommit:
+		return "commit"
+	case TraceFlush:
+		return "flush"
+	case TraceArchive:
+		return "archive"
+	case TraceCompact:
+		return "compact"
+	}
+
+	return "unknown"
+}
+
+// Trace is the outcome of a traced operation, see TraceOp for the meaning of each field by operation
+type Trace struct {
+	Op TraceOp
+	// Writable is true for read/write and write transactions
+	Writable bool
+	// Seq is the sequence number of our last commit once the operation completed
+	Seq uint64
+	// Duration is the time taken by the operation
+	Duration time.Duration
+	// Keys is the number of keys affected by the operation
+	Keys int
+	// Lines is the number of log lines written by the operation
+	Lines int
+	// Err is the error encountered by the operation, if any
+	Err error
+}
+
+// TraceFunc is called with the outcome of a traced operation
+// Note: Tracers are called while the database is locked and must not call back into the database
+type TraceFunc func(t Trace)
+
+// hasTracers will return whether or not any tracers are registered
+func (h *Hippy) hasTracers() bool {
+	return len(h.opts.Trace) > 0
+}
+
+// trace will call the tracers in order
+func (h *Hippy) trace(t Trace) {
+	for _, fn := range h.opts.Trace {
+		fn(t)
+	}
+}
+
+// begin will record a transaction acquiring it's lock after waiting since start
+func (h *Hippy) begin(start time.Time, writable bool) {
+	wait := time.Since(start)
+	if writable {
+		h.st.wlock.observe(wait)
+	} else {
+		h.st.rlock.observe(wait)
+	}
+
+	if h.hasTracers() {
+		h.trace(Trace{Op: TraceBegin, Writable: writable, Seq: h.seq, Duration: wait})
+	}
+}
+
+// maintained will record the outcome of an archive or compaction which began at start
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (h *Hippy) maintained(t Trace, start time.Time) {
+	t.Seq = h.seq
+	t.Duration = time.Since(start)
+	switch {
+	case t.Err == nil && t.Op == TraceArchive:
+		h.st.archive.observe(t.Duration)
+	case t.Err == nil:
+		h.st.compact.observe(t.Duration)
+	case t.Err != ErrNoChanges:
+		h.log.Error(t.Op.String()+" failed", "seq", t.Seq, "lines", t.Lines, "duration", t.Duration, "err", t.Err)
+	}
+
+	if h.hasTracers() {
+		h.trace(t)
+	}
+}
+
+// changeCount will return the number of keys changed by a transaction, a dropped bucket counts as a single change
+func changeCount(a map[string]action, b bucketChanges) (n int) {
+	n = len(a)
+	for _, ba := range b {
+		if n += len(ba.a); ba.drop {
+			n++
+		}
+	}
+
+	return
+}
@@ -1,6 +1,11 @@
 package hippy
 
-import "sync"
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+)
 
 // ReadTx is a read-only transaction
 type ReadTx struct {
@@ -17,6 +22,12 @@ func (r *ReadTx) Get(k string) (b []byte, ok bool) {
 		return
 	}
 
+	if r.h.isExpired(k, time.Now().UnixNano()) {
+		// Target has expired, set ok to false and return
+		ok = false
+		return
+	}
+
 	if !r.h.opts.CopyOnRead {
 		b = tgt
 		return
@@ -31,17 +42,87 @@ func (r *ReadTx) Get(k string) (b []byte, ok bool) {
 
 // Keys will list the keys for a DB
 func (r *ReadTx) Keys() (keys []string) {
+	now := time.Now().UnixNano()
 	// Pre-allocate keys to be the length of our internal storage
 	keys = make([]string, 0, len(r.h.s))
 
 	// For each item in our internal storage, append key to keys
 	for k := range r.h.s {
+		if r.h.isExpired(k, now) {
+			continue
+		}
+
 		keys = append(keys, k)
 	}
 
 	return
 }
 
+// KeysAfter will return up to limit keys with the provided prefix which sort after the provided key, in order. More is true
+// when further keys remain, they are listed by providing the last returned key as after
+// Note: Every key is visited, but only limit keys are retained and sorted
+func (r *ReadTx) KeysAfter(prefix, after string, limit int) (keys []string, more bool) {
+	var kh keyHeap
+	if limit < 1 {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	for k := range r.h.s {
+		if k <= after || !strings.HasPrefix(k, prefix) || r.h.isExpired(k, now) {
+			continue
+		}
+
+		// Retain an additional key so that we know whether any remain
+		kh.offer(k, limit+1)
+	}
+
+	if keys = kh.sorted(); len(keys) > limit {
+		keys = keys[:limit]
+		more = true
+	}
+
+	return
+}
+
+// Expiry will return the expiry of a key, ok is false if the key does not exist, does not expire, or has expired
+func (r *ReadTx) Expiry(k string) (exp time.Time, ok bool) {
+	var e int64
+	if e, ok = r.h.e[k]; !ok {
+		return
+	}
+
+	if e <= time.Now().UnixNano() {
+		// Key has expired and is awaiting the reaper, it does not exist as far as Get is concerned
+		ok = false
+		return
+	}
+
+	exp = time.Unix(0, e)
+	return
+}
+
+// Bucket will return a read-only view of the bucket with the provided name
+func (r *ReadTx) Bucket(name string) *ReadBucket {
+	return &ReadBucket{h: r.h, name: name}
+}
+
+// Buckets will list the buckets for a DB
+func (r *ReadTx) Buckets() (names []string) {
+	// Pre-allocate names to be the length of our bucket storage
+	names = make([]string, 0, len(r.h.b))
+	for name := range r.h.b {
+		names = append(names, name)
+	}
+
+	return
+}
+
+// Index will return a read-only view of the index with the provided name
+func (r *ReadTx) Index(name string) *Index {
+	return &Index{h: r.h, idx: r.h.idx[name]}
+}
+
 // ReadWriteTx is a read/write transaction
 type ReadWriteTx struct {
 	mux sync.RWMutex
@@ -50,16 +131,26 @@ type ReadWriteTx struct {
 	h *Hippy
 	// Actions map
 	a map[string]action
+	// Bucket actions map
+	b bucketChanges
 }
 
 // Get will get a body and an ok value
 func (rw *ReadWriteTx) Get(k string) (b []byte, ok bool) {
+	rw.mux.RLock()
+	b, ok = rw.get(k)
+	rw.mux.RUnlock()
+	return
+}
+
+// get will get a body and an ok value
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (rw *ReadWriteTx) get(k string) (b []byte, ok bool) {
 	var (
 		ta  action
 		tgt []byte
 	)
 
-	rw.mux.RLock()
 	// If action exists for this key..
 	if ta, ok = rw.a[k]; ok {
 		// If action is PUT, set our target to the action body and goto copy
@@ -68,32 +159,34 @@ func (rw *ReadWriteTx) Get(k string) (b []byte, ok bool) {
 			goto COPY
 		}
 
-		// Action was DELETE, set ok to false and goto end
+		// Action was DELETE, set ok to false and return
 		ok = false
-		goto END
+		return
 	}
 
 	// Get a non-pointer reference to storage
 	if tgt, ok = rw.h.s[k]; !ok {
-		// Target does not exist, goto end
-		goto END
+		// Target does not exist, return
+		return
+	}
+
+	if rw.h.isExpired(k, time.Now().UnixNano()) {
+		// Target has expired, set ok to false and return
+		ok = false
+		return
 	}
 
 COPY:
 	if !rw.h.opts.CopyOnRead {
 		b = tgt
-		goto END
+		return
 	}
 
 	// Pre-allocate b to be the length of target
 	b = make([]byte, len(tgt))
 	// Copy target to b
 	copy(b, tgt)
-
-END:
-	rw.mux.RUnlock()
 	return
-
 }
 
 // Put will put
@@ -102,9 +195,33 @@ func (rw *ReadWriteTx) Put(k string, v []byte) (err error) {
 		return ErrInvalidKey
 	}
 
-	// Create action
-	act := action{a: _put}
 	rw.mux.Lock()
+	rw.put(k, v, 0)
+	rw.mux.Unlock()
+	return
+}
+
+// PutWithTTL will put a value which expires after the provided TTL
+func (rw *ReadWriteTx) PutWithTTL(k string, v []byte, ttl time.Duration) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	rw.mux.Lock()
+	rw.put(k, v, time.Now().Add(ttl).UnixNano())
+	rw.mux.Unlock()
+	return
+}
+
+// put will set a put action for a key with the provided expiry (in unix nanoseconds)
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (rw *ReadWriteTx) put(k string, v []byte, exp int64) {
+	// Create action
+	act := action{a: _put, e: exp}
 	if !rw.h.opts.CopyOnWrite {
 		// Set action body to value and goto the end
 		act.b = v
@@ -118,8 +235,6 @@ func (rw *ReadWriteTx) Put(k string, v []byte) (err error) {
 
 END:
 	rw.a[k] = act
-	rw.mux.Unlock()
-	return
 }
 
 // Del will delete
@@ -132,24 +247,207 @@ func (rw *ReadWriteTx) Del(k string) {
 	rw.mux.Unlock()
 }
 
-// Keys will list the keys for a DB
+// CompareAndSwap will put the new value for a key only if the current value is equal to old.
+// Swapped will be false if the key does not exist or if the current value does not match. The key retains it's expiry
+func (rw *ReadWriteTx) CompareAndSwap(k string, old, new []byte) (swapped bool, err error) {
+	var (
+		cur []byte
+		ok  bool
+	)
+
+	if len(k) > MaxKeyLen {
+		err = ErrInvalidKey
+		return
+	}
+
+	rw.mux.Lock()
+	if cur, ok = rw.get(k); !ok || !bytes.Equal(cur, old) {
+		// Key does not exist or the current value does not match, goto end
+		goto END
+	}
+
+	// Our swap retains the current expiry of the key
+	rw.put(k, new, rw.expiry(k))
+	swapped = true
+
+END:
+	rw.mux.Unlock()
+	return
+}
+
+// PutIfAbsent will put the value for a key only if the key does not currently exist
+func (rw *ReadWriteTx) PutIfAbsent(k string, v []byte) (put bool, err error) {
+	if len(k) > MaxKeyLen {
+		err = ErrInvalidKey
+		return
+	}
+
+	rw.mux.Lock()
+	if _, ok := rw.get(k); !ok {
+		rw.put(k, v, 0)
+		put = true
+	}
+	rw.mux.Unlock()
+	return
+}
+
+// DelIfEqual will delete a key only if the current value is equal to the provided value
+func (rw *ReadWriteTx) DelIfEqual(k string, v []byte) (deleted bool, err error) {
+	if len(k) > MaxKeyLen {
+		err = ErrInvalidKey
+		return
+	}
+
+	rw.mux.Lock()
+	if cur, ok := rw.get(k); ok && bytes.Equal(cur, v) {
+		// Set a delete action
+		rw.a[k] = action{
+			a: _del,
+		}
+
+		deleted = true
+	}
+	rw.mux.Unlock()
+	return
+}
+
+// Incr will increment the integer stored at a key by delta and return the new value
+// Note: A missing key is treated as zero and an existing key retains it's expiry. Values are expected to be encoded with
+// EncodeInt64, ErrInvalidInt is returned for values which are not 8 bytes. Decimal strings, such as those written by the
+// resp package's INCR, are not supported
+func (rw *ReadWriteTx) Incr(k string, delta int64) (n int64, err error) {
+	if len(k) > MaxKeyLen {
+		err = ErrInvalidKey
+		return
+	}
+
+	var exp int64
+	rw.mux.Lock()
+	if b, ok := rw.get(k); ok {
+		if n, err = DecodeInt64(b); err != nil {
+			goto END
+		}
+
+		// An existing counter retains it's expiry
+		exp = rw.expiry(k)
+	}
+
+	n += delta
+	rw.put(k, EncodeInt64(n), exp)
+
+END:
+	rw.mux.Unlock()
+	return
+}
+
+// Keys will list the keys for a DB, including any changes made within this transaction
 func (rw *ReadWriteTx) Keys() (keys []string) {
+	now := time.Now().UnixNano()
+	rw.mux.RLock()
 	// Pre-allocate keys to be the length of our internal storage
 	keys = make([]string, 0, len(rw.h.s))
-	// For each item in our internal storage, append key to keys
+	// For each item in our internal storage which has not been modified, append key to keys
 	for k := range rw.h.s {
+		if _, ok := rw.a[k]; ok {
+			continue
+		}
+
+		if rw.h.isExpired(k, now) {
+			continue
+		}
+
 		keys = append(keys, k)
 	}
 
+	// For each put action, append key to keys
+	for k, act := range rw.a {
+		if act.a == _put {
+			keys = append(keys, k)
+		}
+	}
+	rw.mux.RUnlock()
+	return
+}
+
+// Expiry will return the expiry of a key, including any changes made within this transaction.
+// Ok is false if the key does not exist, does not expire, or has expired
+func (rw *ReadWriteTx) Expiry(k string) (exp time.Time, ok bool) {
+	rw.mux.RLock()
+	e := rw.expiry(k)
+	rw.mux.RUnlock()
+
+	if ok = e > 0; ok {
+		exp = time.Unix(0, e)
+	}
+
 	return
 }
 
+// expiry will return the expiry of a key in unix nanoseconds, zero is returned when the key has no expiry or has expired
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (rw *ReadWriteTx) expiry(k string) int64 {
+	if act, ok := rw.a[k]; ok {
+		// Deleted keys and keys put without a TTL have no expiry
+		return act.e
+	}
+
+	if rw.h.isExpired(k, time.Now().UnixNano()) {
+		// Expired keys do not exist, their expiry must not be carried over by a write
+		return 0
+	}
+
+	return rw.h.e[k]
+}
+
+// Bucket will return a read/write view of the bucket with the provided name
+func (rw *ReadWriteTx) Bucket(name string) *ReadWriteBucket {
+	return &ReadWriteBucket{tx: rw, name: name}
+}
+
+// DeleteBucket will delete a bucket and all of it's contents
+func (rw *ReadWriteTx) DeleteBucket(name string) (err error) {
+	if !isValidBucket(name) {
+		return ErrInvalidBucket
+	}
+
+	rw.mux.Lock()
+	rw.b.drop(name)
+	rw.mux.Unlock()
+	return
+}
+
+// Buckets will list the buckets for a DB, including any changes made within this transaction
+func (rw *ReadWriteTx) Buckets() (names []string) {
+	rw.mux.RLock()
+	for name := range rw.h.b {
+		if _, ok := rw.b[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	for name := range rw.b {
+		if len((&ReadWriteBucket{tx: rw, name: name}).keys()) > 0 {
+			names = append(names, name)
+		}
+	}
+	rw.mux.RUnlock()
+	return
+}
+
+// Index will return a read-only view of the index with the provided name
+// Note: Changes made within this transaction are not reflected until commit
+func (rw *ReadWriteTx) Index(name string) *Index {
+	return &Index{h: rw.h, idx: rw.h.idx[name]}
+}
+
 // WriteTx is a write-only transaction
 type WriteTx struct {
 	mux sync.Mutex
 
 	// Actions map
 	a map[string]action
+	// Bucket actions map
+	b bucketChanges
 }
 
 // Put will put
@@ -168,6 +466,46 @@ func (w *WriteTx) Put(k string, v []byte) (err error) {
 	return
 }
 
+// PutWithTTL will put a value which expires after the provided TTL
+func (w *WriteTx) PutWithTTL(k string, v []byte, ttl time.Duration) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	return w.putWithExpiry(k, v, time.Now().Add(ttl).UnixNano())
+}
+
+// putWithExpiry will put a value which expires at the provided time (in unix nanoseconds), zero will never expire
+func (w *WriteTx) putWithExpiry(k string, v []byte, exp int64) (err error) {
+	if len(k) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+
+	if exp < 0 {
+		return ErrInvalidTTL
+	}
+
+	w.mux.Lock()
+	w.put(k, v, exp)
+	w.mux.Unlock()
+	return
+}
+
+// put will set a put action for a key with the provided expiry (in unix nanoseconds)
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (w *WriteTx) put(k string, v []byte, exp int64) {
+	// Set a put action with the body and expiry
+	w.a[k] = action{
+		a: _put,
+		b: v,
+		e: exp,
+	}
+}
+
 // Del will delete
 func (w *WriteTx) Del(k string) {
 	w.mux.Lock()
@@ -177,3 +515,20 @@ func (w *WriteTx) Del(k string) {
 	}
 	w.mux.Unlock()
 }
+
+// Bucket will return a write-only view of the bucket with the provided name
+func (w *WriteTx) Bucket(name string) *WriteBucket {
+	return &WriteBucket{tx: w, name: name}
+}
+
+// DeleteBucket will delete a bucket and all of it's contents
+func (w *WriteTx) DeleteBucket(name string) (err error) {
+	if !isValidBucket(name) {
+		return ErrInvalidBucket
+	}
+
+	w.mux.Lock()
+	w.b.drop(name)
+	w.mux.Unlock()
+	return
+}
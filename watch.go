@@ -0,0 +1,220 @@
+package hippy
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// EventPut represents a committed PUT
+	EventPut EventType = iota + 1
+	// EventDel represents a committed DELETE
+	EventDel
+	// EventDropBucket represents a committed bucket deletion, the key is empty
+	EventDropBucket
+)
+
+const (
+	// WatchClose will close the channel of a watcher whose buffer is full, consumers are expected to resume from the last sequence they received
+	WatchClose WatchPolicy = iota
+	// WatchDrop will drop events for a watcher whose buffer is full
+	WatchDrop
+)
+
+// defaultWatchBuffer is the default number of events buffered per watcher
+const defaultWatchBuffer = 64
+
+// EventType is the type of a committed change
+type EventType uint8
+
+// WatchPolicy is the policy used for slow consumers
+type WatchPolicy uint8
+
+// Event is a committed change
+// Note: Value is shared with the database and should not be modified
+type Event struct {
+	// Sequence number of the commit which produced this event
+	Seq uint64
+
+	Type   EventType
+	Bucket string // Bucket name, empty for the root keyspace
+	Key    string
+	Value  []byte // Value for PUT events
+}
+
+// watcher is a subscriber to committed changes
+type watcher struct {
+	bucket string // Bucket name, empty for the root keyspace
+	prefix string
+	ch     chan Event
+}
+
+// watchers manages the subscribers to committed changes
+type watchers struct {
+	mux sync.Mutex
+
+	policy WatchPolicy
+	buffer int
+
+	m map[*watcher]struct{}
+
+	closed bool // Closed state
+}
+
+// add will add a new watcher for the provided bucket and prefix
+func (ws *watchers) add(bucket, prefix string) (w *watcher) {
+	buffer := ws.buffer
+	if buffer <= 0 {
+		buffer = defaultWatchBuffer
+	}
+
+	w = &watcher{
+		bucket: bucket,
+		prefix: prefix,
+		ch:     make(chan Event, buffer),
+	}
+
+	ws.mux.Lock()
+	if ws.closed {
+		// Watchers have been closed, close our channel and return
+		close(w.ch)
+		goto END
+	}
+
+	if ws.m == nil {
+		ws.m = make(map[*watcher]struct{})
+	}
+
+	ws.m[w] = struct{}{}
+
+END:
+	ws.mux.Unlock()
+	return
+}
+
+// remove will remove a watcher and close it's channel, if it has not already been removed
+func (ws *watchers) remove(w *watcher) {
+	ws.mux.Lock()
+	ws.removeUnsafe(w)
+	ws.mux.Unlock()
+}
+
+// removeUnsafe will remove a watcher and close it's channel, if it has not already been removed
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (ws *watchers) removeUnsafe(w *watcher) {
+	if _, ok := ws.m[w]; !ok {
+		return
+	}
+
+	delete(ws.m, w)
+	close(w.ch)
+}
+
+// closeAll will remove all watchers and prevent any new watchers from being added
+func (ws *watchers) closeAll() {
+	ws.mux.Lock()
+	ws.closed = true
+	for w := range ws.m {
+		ws.removeUnsafe(w)
+	}
+	ws.mux.Unlock()
+}
+
+// notify will send the changes for a commit to all matching watchers
+func (ws *watchers) notify(seq uint64, a map[string]action, b bucketChanges) {
+	ws.mux.Lock()
+	if len(ws.m) == 0 {
+		goto END
+	}
+
+	for _, e := range newEvents(seq, a, b) {
+		ws.send(e)
+	}
+
+END:
+	ws.mux.Unlock()
+}
+
+// notifyEvent will send an event to all matching watchers
+func (ws *watchers) notifyEvent(e Event) {
+	ws.mux.Lock()
+	ws.send(e)
+	ws.mux.Unlock()
+}
+
+// send will send an event to all matching watchers without blocking
+// Note: This is not thread safe. It is expected that the calling function is managing locks
+func (ws *watchers) send(e Event) {
+	for w := range ws.m {
+		if !w.matches(e) {
+			continue
+		}
+
+		select {
+		case w.ch <- e:
+		default:
+			// Watcher buffer is full
+			if ws.policy == WatchClose {
+				ws.removeUnsafe(w)
+			}
+		}
+	}
+}
+
+// matches will return whether or not an event is within our bucket and prefix, a dropped bucket matches every prefix
+func (w *watcher) matches(e Event) bool {
+	if e.Bucket != w.bucket {
+		return false
+	}
+
+	return e.Type == EventDropBucket || strings.HasPrefix(e.Key, w.prefix)
+}
+
+// newEvents will return the events for a set of transaction changes. Events are ordered by bucket and then key, root keys
+// come first and a dropped bucket precedes any changes made to it afterwards
+func newEvents(seq uint64, a map[string]action, b bucketChanges) (es []Event) {
+	for name, ba := range b {
+		if ba.drop {
+			es = append(es, Event{Seq: seq, Type: EventDropBucket, Bucket: name})
+		}
+
+		for k, v := range ba.a {
+			es = append(es, newEvent(seq, name, k, v))
+		}
+	}
+
+	for k, v := range a {
+		es = append(es, newEvent(seq, "", k, v))
+	}
+
+	// Our changes are held within maps, sort them so that feeds are deterministic
+	sort.Slice(es, func(i, j int) bool {
+		switch {
+		case es[i].Bucket != es[j].Bucket:
+			return es[i].Bucket < es[j].Bucket
+		case es[i].Type == EventDropBucket || es[j].Type == EventDropBucket:
+			return es[i].Type == EventDropBucket
+		}
+
+		return es[i].Key < es[j].Key
+	})
+
+	return
+}
+
+// newEvent will return a new event for an action
+func newEvent(seq uint64, bucket, key string, v action) (e Event) {
+	e.Seq = seq
+	e.Bucket = bucket
+	e.Key = key
+
+	if v.a == _put {
+		e.Type = EventPut
+		e.Value = v.b
+	} else {
+		e.Type = EventDel
+	}
+
+	return
+}